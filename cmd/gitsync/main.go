@@ -1,10 +1,13 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/nieomylnieja/gitsync/internal/config"
 	"github.com/nieomylnieja/gitsync/internal/gitsync"
@@ -17,61 +20,310 @@ func main() {
 	}
 }
 
+const usage = `Usage: gitsync [options] <command>
+
+Commands:
+  sync             interactively synchronize the files and open pull requests,
+                   run 'gitsync sync -h' for details
+  diff             show the differences between the root and synchronized files
+  upstream         interactively propose a synchronized repository's changes back
+                   to the root repository, run 'gitsync upstream -h' for details
+  init             scaffold a config file from existing repositories,
+                   run 'gitsync init -h' for details
+  repos            list the synchronized repositories, including the discovered ones
+  config schema    print the JSON Schema of the config file
+  config validate  validate the config file and report all the problems found
+  store gc         remove the repositories which are no longer in the config from the store,
+                   run 'gitsync store gc -h' for details
+
+Options:
+`
+
 func run() error {
 	flag.Usage = func() {
-		_, _ = fmt.Fprintln(flag.CommandLine.Output(), "Usage: gitsync [options] [command]")
+		_, _ = fmt.Fprint(flag.CommandLine.Output(), usage)
 		flag.PrintDefaults()
 	}
 	configPath := flag.String("c", "", "path to the configuration file")
+	var tags stringSliceFlag
+	flag.Var(&tags, "tag", "only synchronize repositories with the given tag (can be repeated)")
 	flag.Parse()
-	if flag.NArg() != 1 {
-		_, _ = fmt.Fprintln(flag.CommandLine.Output(),
-			"error: invalid number of arguments, provide either 'sync' or 'diff' command")
-		flag.Usage()
-		os.Exit(1)
+	if flag.NArg() == 0 {
+		exitWithUsage("invalid number of arguments, provide a command")
 	}
-	var command gitsync.Command
 	switch flag.Arg(0) {
 	case "sync":
-		command = gitsync.CommandSync
+		return runSync(*configPath, gitsync.CommandSync, gitsync.Options{Tags: tags}, flag.Args()[1:])
 	case "diff":
-		command = gitsync.CommandDiff
+		return runSync(*configPath, gitsync.CommandDiff, gitsync.Options{Tags: tags}, flag.Args()[1:])
+	case "upstream":
+		return runUpstream(*configPath, flag.Args()[1:])
+	case "init":
+		return runInit(*configPath, flag.Args()[1:])
+	case "repos":
+		return runRepos(*configPath, tags)
+	case "config":
+		return runConfig(*configPath, flag.Args()[1:])
+	case "store":
+		return runStore(*configPath, flag.Args()[1:])
 	default:
-		_, _ = fmt.Fprintln(flag.CommandLine.Output(), "error: invalid command, provide either 'sync' or 'diff'")
-		flag.Usage()
-		os.Exit(1)
+		exitWithUsage("invalid command: %s", flag.Arg(0))
 	}
-	if configPath == nil || *configPath == "" {
-		defaultConfigPath := getDefaultConfigPath()
-		if _, err := os.Stat(defaultConfigPath); err != nil {
-			_, _ = fmt.Fprintf(flag.CommandLine.Output(),
-				"error: '-c' was not provided and there was no default config file located at: %s\n",
-				defaultConfigPath)
-			flag.Usage()
-			os.Exit(1)
-		} else {
-			configPath = &defaultConfigPath
+	return nil
+}
+
+func runSync(configPath string, command gitsync.Command, opts gitsync.Options, args []string) error {
+	if command == gitsync.CommandSync {
+		flags := flag.NewFlagSet("sync", flag.ExitOnError)
+		flags.Usage = func() {
+			_, _ = fmt.Fprintln(flags.Output(), "Usage: gitsync [options] sync [--dry-run]")
+			flags.PrintDefaults()
 		}
+		flags.BoolVar(&opts.DryRun, "dry-run", false,
+			"apply the changes locally and print the commit message and pull request, "+
+				"without committing, pushing and opening pull requests")
+		_ = flags.Parse(args)
+		args = flags.Args()
+	}
+	if len(args) > 0 {
+		exitWithUsage("'%s' command does not accept any arguments", flag.Arg(0))
+	}
+	conf, err := config.ReadConfig(resolveConfigPath(configPath))
+	if err != nil {
+		return err
+	}
+	if err = gitsync.Run(conf, command, opts); err != nil {
+		return err
+	}
+	// Dry run must not modify anything, including the hunks ignored with the prompt.
+	if opts.DryRun {
+		return nil
+	}
+	if err = conf.Save(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func runUpstream(configPath string, args []string) error {
+	flags := flag.NewFlagSet("upstream", flag.ExitOnError)
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(flags.Output(),
+			"Usage: gitsync [-c path] upstream --from <repo> [--file <name>...] [--dry-run]")
+		flags.PrintDefaults()
+	}
+	var opts gitsync.UpstreamOptions
+	flags.StringVar(&opts.From, "from", "", "name of the synchronized repository to propose the changes from")
+	var files stringSliceFlag
+	flags.Var(&files, "file", "only synchronize the file with the given name (can be repeated)")
+	flags.BoolVar(&opts.DryRun, "dry-run", false,
+		"apply the changes locally and print the commit message and pull request, "+
+			"without committing, pushing and opening pull requests")
+	_ = flags.Parse(args)
+	switch {
+	case flags.NArg() > 0:
+		_, _ = fmt.Fprintf(flags.Output(), "error: unexpected arguments: %s\n", strings.Join(flags.Args(), " "))
+		flags.Usage()
+		os.Exit(1)
+	case opts.From == "":
+		_, _ = fmt.Fprintln(flags.Output(), "error: '--from' is required")
+		flags.Usage()
+		os.Exit(1)
 	}
-	conf, err := config.ReadConfig(*configPath)
+	opts.Files = files
+	conf, err := config.ReadConfig(resolveConfigPath(configPath))
 	if err != nil {
 		return err
 	}
-	if err = gitsync.Run(conf, command); err != nil {
+	if err = gitsync.Upstream(conf, opts); err != nil {
+		return err
+	}
+	// Hunks ignored with the prompt are saved to the config, unless it's a dry run.
+	if opts.DryRun {
+		return nil
+	}
+	return conf.Save()
+}
+
+func runInit(configPath string, args []string) error {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(flags.Output(), "Usage: gitsync [-c path] init --root <url> --repo <url>...")
+		flags.PrintDefaults()
+	}
+	rootURL := flags.String("root", "", "URL of the root repository")
+	var repoURLs stringSliceFlag
+	flags.Var(&repoURLs, "repo", "URL of the synchronized repository (can be repeated)")
+	force := flags.Bool("force", false, "overwrite the config file if it already exists")
+	_ = flags.Parse(args)
+	if *rootURL == "" || len(repoURLs) == 0 || flags.NArg() > 0 {
+		_, _ = fmt.Fprintln(flags.Output(), "error: '--root' and at least one '--repo' are required")
+		flags.Usage()
+		os.Exit(1)
+	}
+	if configPath == "" {
+		configPath = getDefaultConfigPath()
+	}
+	if _, err := os.Stat(configPath); err == nil && !*force {
+		return fmt.Errorf("config file already exists at %s, use '--force' to overwrite it", configPath)
+	}
+	conf, err := gitsync.Init(gitsync.InitOptions{
+		ConfigPath: configPath,
+		RootURL:    *rootURL,
+		RepoURLs:   repoURLs,
+	})
+	if err != nil {
 		return err
 	}
+	// #nosec G301
+	if err = os.MkdirAll(filepath.Dir(configPath), 0o750); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
 	if err = conf.Save(); err != nil {
 		return err
 	}
+	fmt.Printf("Config written to %s, review the suggested files before running 'sync'.\n", configPath)
+	return nil
+}
+
+func runRepos(configPath string, tags []string) error {
+	if flag.NArg() != 1 {
+		exitWithUsage("'repos' command does not accept any arguments")
+	}
+	conf, err := config.ReadConfig(resolveConfigPath(configPath))
+	if err != nil {
+		return err
+	}
+	if err = gitsync.DiscoverRepositories(conf); err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NAME\tURL\tREF\tTAGS\tSOURCE")
+	for _, repo := range conf.Repositories {
+		if len(tags) > 0 && !repo.HasAnyTag(tags...) {
+			continue
+		}
+		source := "config"
+		if repo.IsDiscovered() {
+			source = "discovered"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			repo.Name, repo.URL, repo.GetRef(), strings.Join(repo.Tags, ","), source)
+	}
+	return w.Flush()
+}
+
+func runConfig(configPath string, args []string) error {
+	if len(args) != 1 {
+		exitWithUsage("'config' command requires exactly one subcommand, provide either 'schema' or 'validate'")
+	}
+	switch args[0] {
+	case "schema":
+		schema, err := config.Schema()
+		if err != nil {
+			return fmt.Errorf("failed to generate config JSON Schema: %w", err)
+		}
+		fmt.Print(string(schema))
+	case "validate":
+		path := resolveConfigPath(configPath)
+		if _, err := config.ReadConfig(path); err != nil {
+			var validationErrs config.ValidationErrors
+			if !errors.As(err, &validationErrs) {
+				return err
+			}
+			fmt.Printf("Found %d problem(s) in %s:\n", len(validationErrs), path)
+			for _, validationErr := range validationErrs {
+				fmt.Printf("  - %s\n", validationErr)
+			}
+			return errors.New("config validation failed")
+		}
+		fmt.Printf("%s is valid.\n", path)
+	default:
+		exitWithUsage("invalid 'config' subcommand: %s, provide either 'schema' or 'validate'", args[0])
+	}
+	return nil
+}
+
+func runStore(configPath string, args []string) error {
+	if len(args) == 0 || args[0] != "gc" {
+		exitWithUsage("'store' command requires exactly one subcommand, provide 'gc'")
+	}
+	flags := flag.NewFlagSet("store gc", flag.ExitOnError)
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(flags.Output(), "Usage: gitsync [-c path] store gc [--dry-run] [--force]")
+		flags.PrintDefaults()
+	}
+	var opts gitsync.PruneOptions
+	flags.BoolVar(&opts.DryRun, "dry-run", false, "only list the stale repositories, without removing them")
+	flags.BoolVar(&opts.Force, "force", false, "remove the stale repositories without asking for confirmation")
+	_ = flags.Parse(args[1:])
+	if flags.NArg() > 0 {
+		_, _ = fmt.Fprintf(flags.Output(), "error: unexpected arguments: %s\n", strings.Join(flags.Args(), " "))
+		flags.Usage()
+		os.Exit(1)
+	}
+	conf, err := config.ReadConfig(resolveConfigPath(configPath))
+	if err != nil {
+		return err
+	}
+	// Discovered repositories must be known, otherwise their checkouts would be removed.
+	if err = gitsync.DiscoverRepositories(conf); err != nil {
+		return err
+	}
+	removed, err := gitsync.PruneStore(conf, opts)
+	if err != nil {
+		return err
+	}
+	if opts.DryRun {
+		fmt.Printf("Would remove %d stale repositories from %s.\n", len(removed), conf.GetStorePath())
+		return nil
+	}
+	fmt.Printf("Removed %d stale repositories from %s.\n", len(removed), conf.GetStorePath())
 	return nil
 }
 
+// resolveConfigPath returns the config path, falling back to the default one if it was not provided.
+func resolveConfigPath(configPath string) string {
+	if configPath != "" {
+		return configPath
+	}
+	defaultConfigPath := getDefaultConfigPath()
+	if _, err := os.Stat(defaultConfigPath); err != nil {
+		exitWithUsage("'-c' was not provided and there was no default config file located at: %s",
+			defaultConfigPath)
+	}
+	return defaultConfigPath
+}
+
+func exitWithUsage(format string, a ...any) {
+	_, _ = fmt.Fprintf(flag.CommandLine.Output(), "error: "+format+"\n", a...)
+	flag.Usage()
+	os.Exit(1)
+}
+
 func getDefaultConfigPath() string {
-	var path string
+	var dir string
 	if xdgConfigHome, ok := os.LookupEnv("XDG_CONFIG_HOME"); ok {
-		path = filepath.Join(xdgConfigHome, "gitsync", "config.json")
+		dir = filepath.Join(xdgConfigHome, "gitsync")
 	} else {
-		path = os.ExpandEnv(filepath.Join("$HOME", ".config", "gitsync", "config.json"))
+		dir = os.ExpandEnv(filepath.Join("$HOME", ".config", "gitsync"))
 	}
-	return path
+	for _, name := range []string{"config.yaml", "config.yml"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return filepath.Join(dir, name)
+		}
+	}
+	return filepath.Join(dir, "config.json")
+}
+
+// stringSliceFlag is a [flag.Value] which collects the values of a repeated flag.
+type stringSliceFlag []string
+
+func (s *stringSliceFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSliceFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
 }
@@ -2,10 +2,10 @@ package config
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/nieomylnieja/gitsync/internal/diff"
@@ -14,14 +14,48 @@ import (
 const defaultRef = "origin/main"
 
 type Config struct {
-	StorePath    string        `json:"storePath,omitempty"`
-	Root         *Repository   `json:"root"`
-	Ignore       []*IgnoreRule `json:"ignore,omitempty"`
-	Repositories []*Repository `json:"syncRepositories"`
-	SyncFiles    []*File       `json:"syncFiles"`
+	// JSONSchema is the URL of the config file's JSON Schema, it allows editors to validate the file.
+	JSONSchema string `json:"$schema,omitempty" yaml:"$schema,omitempty"`
+	// Include is a list of paths to other config files which are merged with this config.
+	Include   []string    `json:"include,omitempty" yaml:"include,omitempty"`
+	StorePath string      `json:"storePath,omitempty" yaml:"storePath,omitempty"`
+	Root      *Repository `json:"root" yaml:"root"`
+	// Ignore rules are not interpolated with environment variables,
+	// as both regular expressions and hunks often contain '${' sequences, e.g. in GitHub workflows.
+	Ignore       []*IgnoreRule `json:"ignore,omitempty" yaml:"ignore,omitempty" env:"-"`
+	Repositories []*Repository `json:"syncRepositories" yaml:"syncRepositories"`
+	// Discover defines queries for synchronized repositories resolved through the forge API,
+	// which are merged with the explicitly defined [Config.Repositories].
+	Discover  []*Discovery `json:"discover,omitempty" yaml:"discover,omitempty"`
+	SyncFiles []*File      `json:"syncFiles" yaml:"syncFiles"`
+	// Clone defines how the repositories are cloned and fetched into the store.
+	// It can be overridden for each repository with [Repository.Clone].
+	Clone *CloneOptions `json:"clone,omitempty" yaml:"clone,omitempty"`
+	// Templates define the sync branch name, commit message and pull request text.
+	// They can be overridden for each repository with [Repository.Templates].
+	Templates *Templates `json:"templates,omitempty" yaml:"templates,omitempty"`
+	// PushStrategy defines how the sync branch is updated if it already exists on the remote.
+	// It can be overridden for each repository with [Repository.PushStrategy].
+	PushStrategy PushStrategy `json:"pushStrategy,omitempty" yaml:"pushStrategy,omitempty"`
+	// Delivery defines how the synchronized changes are delivered to the repositories.
+	// It can be overridden for each repository with [Repository.Delivery].
+	Delivery Delivery `json:"delivery,omitempty" yaml:"delivery,omitempty"`
+	// PullRequest defines the options of the opened pull requests.
+	// They can be overridden for each repository with [Repository.PullRequest].
+	PullRequest *PullRequestOptions `json:"pullRequest,omitempty" yaml:"pullRequest,omitempty"`
+	// Commit defines the identity and signing of the sync commits.
+	// It can be overridden for each repository with [Repository.Commit].
+	Commit *CommitOptions `json:"commit,omitempty" yaml:"commit,omitempty"`
 
 	path              string
+	format            format
+	raw               []byte
+	snapshot          map[string]json.RawMessage
 	resolvedStorePath string
+	// document is the config as defined in the file under path, without its includes.
+	document *Config
+	// origins maps repositories, files and ignore rules to the paths of config files which defined them.
+	origins map[any]string
 }
 
 func (c *Config) GetPath() string {
@@ -33,12 +67,45 @@ func (c *Config) GetStorePath() string {
 }
 
 type Repository struct {
-	Name string `json:"name"`
-	URL  string `json:"url"`
-	Ref  string `json:"ref,omitempty"`
+	Name string            `json:"name" yaml:"name"`
+	URL  string            `json:"url" yaml:"url"`
+	Ref  string            `json:"ref,omitempty" yaml:"ref,omitempty"`
+	Vars map[string]string `json:"vars,omitempty" yaml:"vars,omitempty"`
+	Tags []string          `json:"tags,omitempty" yaml:"tags,omitempty"`
+	// Clone overrides [Config.Clone] for the repository.
+	Clone *CloneOptions `json:"clone,omitempty" yaml:"clone,omitempty"`
+	// Templates override [Config.Templates] for the repository, each template separately.
+	Templates *Templates `json:"templates,omitempty" yaml:"templates,omitempty"`
+	// PushStrategy overrides [Config.PushStrategy] for the repository.
+	PushStrategy PushStrategy `json:"pushStrategy,omitempty" yaml:"pushStrategy,omitempty"`
+	// Delivery overrides [Config.Delivery] for the repository.
+	Delivery Delivery `json:"delivery,omitempty" yaml:"delivery,omitempty"`
+	// PushBranch, if set, is the branch the changes are pushed to with [DeliveryPush], e.g. 'main'
+	// for repositories without pull requests, like mirrors. It is never force pushed.
+	// By default, the sync branch is pushed.
+	PushBranch string `json:"pushBranch,omitempty" yaml:"pushBranch,omitempty"`
+	// PullRequest overrides [Config.PullRequest] for the repository, each option separately.
+	PullRequest *PullRequestOptions `json:"pullRequest,omitempty" yaml:"pullRequest,omitempty"`
+	// Commit overrides [Config.Commit] for the repository, each option separately.
+	Commit *CommitOptions `json:"commit,omitempty" yaml:"commit,omitempty"`
+	// Hooks are shell commands run in the repository after the files were updated and before the changes
+	// are committed, e.g. 'go mod tidy'. They run after the hooks of the updated [File] entries.
+	// If any of the hooks fails, the changes are not committed.
+	// Files changed by the hooks are committed along with the synchronized files.
+	Hooks []string `json:"hooks,omitempty" yaml:"hooks,omitempty"`
+	// Fork, if set, makes the sync branch be pushed to the repository's fork instead of the repository itself
+	// and the pull request be opened from the fork, which does not require write access to the repository.
+	Fork *ForkOptions `json:"fork,omitempty" yaml:"fork,omitempty"`
 
 	path       string
 	defaultRef string
+	discovered bool
+	clone      CloneOptions
+	templates  Templates
+	push       PushStrategy
+	delivery   Delivery
+	pr         PullRequestOptions
+	commit     CommitOptions
 }
 
 func (r *Repository) GetPath() string {
@@ -52,53 +119,391 @@ func (r *Repository) GetRef() string {
 	return r.defaultRef
 }
 
+// GetCloneOptions returns the effective [CloneOptions] of the repository.
+func (r *Repository) GetCloneOptions() CloneOptions {
+	return r.clone
+}
+
+// GetTemplates returns the effective [Templates] of the repository.
+// Templates which are not defined are empty.
+func (r *Repository) GetTemplates() Templates {
+	return r.templates
+}
+
+// Templates are [text/template] definitions used to describe the synchronized changes.
+// Empty templates fall back to the defaults.
+type Templates struct {
+	// Branch is the name of the branch the changes are pushed to.
+	Branch string `json:"branch,omitempty" yaml:"branch,omitempty"`
+	// CommitTitle is the first line of the commit message.
+	CommitTitle string `json:"commitTitle,omitempty" yaml:"commitTitle,omitempty"`
+	// CommitBody is the commit message following the title.
+	CommitBody       string `json:"commitBody,omitempty" yaml:"commitBody,omitempty"`
+	PullRequestTitle string `json:"pullRequestTitle,omitempty" yaml:"pullRequestTitle,omitempty"`
+	PullRequestBody  string `json:"pullRequestBody,omitempty" yaml:"pullRequestBody,omitempty"`
+}
+
+// override returns the templates with the non-empty templates of other taking precedence.
+func (t Templates) override(other *Templates) Templates {
+	if other == nil {
+		return t
+	}
+	for _, field := range []struct{ dst, src *string }{
+		{&t.Branch, &other.Branch},
+		{&t.CommitTitle, &other.CommitTitle},
+		{&t.CommitBody, &other.CommitBody},
+		{&t.PullRequestTitle, &other.PullRequestTitle},
+		{&t.PullRequestBody, &other.PullRequestBody},
+	} {
+		if *field.src != "" {
+			*field.dst = *field.src
+		}
+	}
+	return t
+}
+
+// GetPushStrategy returns the effective [PushStrategy] of the repository.
+func (r *Repository) GetPushStrategy() PushStrategy {
+	return r.push
+}
+
+// PushStrategy defines how the sync branch is updated if it already exists on the remote.
+// If the remote branch already has the same content, it is never updated.
+type PushStrategy string
+
+const (
+	// PushStrategyForce recreates the sync branch from the tracked ref and force pushes it.
+	PushStrategyForce PushStrategy = "force"
+	// PushStrategyAppend adds a commit on top of the remote sync branch, preserving its history.
+	PushStrategyAppend PushStrategy = "append"
+)
+
+// GetDelivery returns the effective [Delivery] of the repository.
+func (r *Repository) GetDelivery() Delivery {
+	return r.delivery
+}
+
+// Delivery defines how the synchronized changes are delivered to the repository.
+type Delivery string
+
+const (
+	// DeliveryPullRequest pushes the sync branch and opens a pull request for it.
+	DeliveryPullRequest Delivery = "pr"
+	// DeliveryPush pushes the sync branch, or [Repository.PushBranch] if set, without opening a pull request.
+	DeliveryPush Delivery = "push"
+	// DeliveryLocal only commits the changes to the sync branch of the store checkout.
+	DeliveryLocal Delivery = "local"
+)
+
+// GetPullRequestOptions returns the effective [PullRequestOptions] of the repository.
+func (r *Repository) GetPullRequestOptions() PullRequestOptions {
+	return r.pr
+}
+
+// PullRequestOptions define the options of the opened pull requests.
+// All the options are applied both when the pull request is opened and updated.
+type PullRequestOptions struct {
+	Labels []string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	// Reviewers are the users requested to review the pull request.
+	Reviewers []string `json:"reviewers,omitempty" yaml:"reviewers,omitempty"`
+	// TeamReviewers are the teams requested to review the pull request, e.g. 'my-org/my-team'.
+	TeamReviewers []string `json:"teamReviewers,omitempty" yaml:"teamReviewers,omitempty"`
+	// Assignees default to the authenticated user ('@me'), set to an empty list to disable assigning.
+	Assignees []string `json:"assignees,omitempty" yaml:"assignees,omitempty"`
+	// Draft, if true, opens the pull request as a draft.
+	// If set explicitly, the existing pull request is converted to a draft or marked as ready for review.
+	Draft *bool `json:"draft,omitempty" yaml:"draft,omitempty"`
+	// AutoMerge, if set, enables auto-merge with the merge method, either 'merge', 'squash' or 'rebase'.
+	AutoMerge MergeMethod `json:"autoMerge,omitempty" yaml:"autoMerge,omitempty"`
+	// CloseObsolete, true by default, closes the open pull request and deletes its branch
+	// once the repository has no remaining differences, e.g. because they were fixed by hand.
+	CloseObsolete *bool `json:"closeObsolete,omitempty" yaml:"closeObsolete,omitempty"`
+}
+
+// IsDraft reports whether the pull request should be opened as a draft.
+func (p PullRequestOptions) IsDraft() bool {
+	return p.Draft != nil && *p.Draft
+}
+
+// ShouldCloseObsolete reports whether the obsolete pull request should be closed.
+func (p PullRequestOptions) ShouldCloseObsolete() bool {
+	return p.CloseObsolete == nil || *p.CloseObsolete
+}
+
+// override returns the options with the defined options of other taking precedence.
+func (p PullRequestOptions) override(other *PullRequestOptions) PullRequestOptions {
+	if other == nil {
+		return p
+	}
+	for _, field := range []struct{ dst, src *[]string }{
+		{&p.Labels, &other.Labels},
+		{&p.Reviewers, &other.Reviewers},
+		{&p.TeamReviewers, &other.TeamReviewers},
+		{&p.Assignees, &other.Assignees},
+	} {
+		if *field.src != nil {
+			*field.dst = *field.src
+		}
+	}
+	if other.Draft != nil {
+		p.Draft = other.Draft
+	}
+	if other.AutoMerge != "" {
+		p.AutoMerge = other.AutoMerge
+	}
+	if other.CloseObsolete != nil {
+		p.CloseObsolete = other.CloseObsolete
+	}
+	return p
+}
+
+// GetCommitOptions returns the effective [CommitOptions] of the repository.
+func (r *Repository) GetCommitOptions() CommitOptions {
+	return r.commit
+}
+
+// CommitOptions define the identity and signing of the sync commits.
+// By default, the git configuration of the user is used.
+type CommitOptions struct {
+	Author *CommitIdentity `json:"author,omitempty" yaml:"author,omitempty"`
+	// Committer defaults to the Author.
+	Committer *CommitIdentity `json:"committer,omitempty" yaml:"committer,omitempty"`
+	// Signing, if set, signs the commits.
+	Signing *SigningOptions `json:"signing,omitempty" yaml:"signing,omitempty"`
+	// Trailers are appended to the commit message, e.g. 'Co-authored-by: Name <email>'.
+	Trailers []string `json:"trailers,omitempty" yaml:"trailers,omitempty"`
+}
+
+// override returns the options with the defined options of other taking precedence.
+func (c CommitOptions) override(other *CommitOptions) CommitOptions {
+	if other == nil {
+		return c
+	}
+	if other.Author != nil {
+		c.Author = other.Author
+	}
+	if other.Committer != nil {
+		c.Committer = other.Committer
+	}
+	if other.Signing != nil {
+		c.Signing = other.Signing
+	}
+	if other.Trailers != nil {
+		c.Trailers = other.Trailers
+	}
+	return c
+}
+
+// CommitIdentity is the name and email of a commit author or committer.
+type CommitIdentity struct {
+	Name  string `json:"name" yaml:"name"`
+	Email string `json:"email" yaml:"email"`
+}
+
+// SigningOptions define how the commits are signed, they are passed through to 'git commit -S'.
+type SigningOptions struct {
+	// Format is either 'gpg' (default) or 'ssh'.
+	Format SigningFormat `json:"format,omitempty" yaml:"format,omitempty"`
+	// Key is the GPG key ID or the path to the SSH key, defaults to git's 'user.signingKey'.
+	Key string `json:"key,omitempty" yaml:"key,omitempty"`
+}
+
+// SigningFormat is the format of the commit signature.
+type SigningFormat string
+
+const (
+	SigningFormatGPG SigningFormat = "gpg"
+	SigningFormatSSH SigningFormat = "ssh"
+)
+
+// ForkOptions define the fork the sync branch is pushed to.
+// The fork is created through the forge API if it does not exist yet.
+type ForkOptions struct {
+	// Owner is the user or organization owning the fork, defaults to the authenticated user.
+	Owner string `json:"owner,omitempty" yaml:"owner,omitempty"`
+	// Name of the fork, defaults to the repository's name.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+}
+
+// MergeMethod is the method used to merge a pull request.
+type MergeMethod string
+
+const (
+	MergeMethodMerge  MergeMethod = "merge"
+	MergeMethodSquash MergeMethod = "squash"
+	MergeMethodRebase MergeMethod = "rebase"
+)
+
+// CloneOptions define how a repository is cloned and fetched.
+// By default, full history of all branches is fetched.
+type CloneOptions struct {
+	// Depth, if greater than 0, creates a shallow clone with history truncated to the number of commits.
+	Depth int `json:"depth,omitempty" yaml:"depth,omitempty"`
+	// Filter is passed to 'git clone --filter', e.g. 'blob:none' creates a partial clone
+	// which downloads file contents only when they're needed.
+	Filter string `json:"filter,omitempty" yaml:"filter,omitempty"`
+	// SingleBranch, if true, clones and fetches only the tracked ref,
+	// which can be a branch, a tag or a full commit SHA.
+	SingleBranch bool `json:"singleBranch,omitempty" yaml:"singleBranch,omitempty"`
+	// Sparse, if true, checks out only the paths of the files to keep in sync.
+	// It is ignored for repositories with hooks, which usually need the whole repository, e.g. 'go mod tidy'.
+	Sparse bool `json:"sparse,omitempty" yaml:"sparse,omitempty"`
+}
+
+// IsDiscovered reports whether the [Repository] was resolved from [Config.Discover] queries.
+func (r *Repository) IsDiscovered() bool {
+	return r.discovered
+}
+
+// Discovery is a query for repositories owned by a forge organization, group or user.
+type Discovery struct {
+	// Owner is the name of the organization, group or user which owns the repositories.
+	Owner string `json:"owner" yaml:"owner"`
+	// Topic, if set, limits the repositories to those with the topic.
+	Topic string `json:"topic,omitempty" yaml:"topic,omitempty"`
+	// NameRegex, if set, limits the repositories to those with names matching the regular expression.
+	NameRegex string `json:"nameRegex,omitempty" yaml:"nameRegex,omitempty"`
+	// IncludeArchived includes archived repositories, which are skipped by default.
+	IncludeArchived bool `json:"includeArchived,omitempty" yaml:"includeArchived,omitempty"`
+	// IncludeForks includes forked repositories, which are skipped by default.
+	IncludeForks bool `json:"includeForks,omitempty" yaml:"includeForks,omitempty"`
+	// Protocol is used to clone the repositories, either 'https' (default) or 'ssh'.
+	Protocol string `json:"protocol,omitempty" yaml:"protocol,omitempty"`
+	// Ref is set for every discovered repository.
+	// It defaults to the repository's default branch.
+	Ref string `json:"ref,omitempty" yaml:"ref,omitempty"`
+	// Tags are added to every discovered repository.
+	Tags []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+}
+
 type File struct {
-	Name string `json:"name"`
-	Path string `json:"path"`
+	Name string `json:"name" yaml:"name"`
+	Path string `json:"path" yaml:"path"`
+	// Template, if set to true, renders the root file with [text/template]
+	// using [Repository.Vars] of the synchronized repository before comparing it.
+	Template bool `json:"template,omitempty" yaml:"template,omitempty"`
+	// Hooks are shell commands run in the synchronized repository after the file was updated,
+	// see [Repository.Hooks].
+	Hooks    []string `json:"hooks,omitempty" yaml:"hooks,omitempty"`
+	Selector `yaml:",inline"`
 }
 
 type IgnoreRule struct {
-	RepositoryName *string     `json:"repositoryName,omitempty"`
-	FileName       *string     `json:"fileName,omitempty"`
-	Regex          []string    `json:"regex,omitempty"`
-	Hunks          []diff.Hunk `json:"hunks,omitempty"`
+	RepositoryName *string     `json:"repositoryName,omitempty" yaml:"repositoryName,omitempty"`
+	FileName       *string     `json:"fileName,omitempty" yaml:"fileName,omitempty"`
+	Regex          []string    `json:"regex,omitempty" yaml:"regex,omitempty"`
+	Hunks          []diff.Hunk `json:"hunks,omitempty" yaml:"hunks,omitempty"`
+	Selector       `yaml:",inline"`
+}
+
+// Selector narrows down the set of synchronized repositories an entity applies to.
+// If neither repositories nor tags are defined, it matches every repository.
+// Otherwise, the repository has to be either listed by name or have at least one of the tags.
+type Selector struct {
+	Repositories []string `json:"repositories,omitempty" yaml:"repositories,omitempty"`
+	Tags         []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+}
+
+// Matches reports whether the [Repository] is selected by the [Selector].
+func (s Selector) Matches(repo *Repository) bool {
+	if len(s.Repositories) == 0 && len(s.Tags) == 0 {
+		return true
+	}
+	if slices.Contains(s.Repositories, repo.Name) {
+		return true
+	}
+	return repo.HasAnyTag(s.Tags...)
+}
+
+// HasAnyTag reports whether the [Repository] has at least one of the provided tags.
+func (r *Repository) HasAnyTag(tags ...string) bool {
+	for _, tag := range tags {
+		if slices.Contains(r.Tags, tag) {
+			return true
+		}
+	}
+	return false
 }
 
+// ReadConfig reads the config file from the provided path.
+// The file is decoded as YAML if it has either '.yaml' or '.yml' extension.
+// Otherwise, it is decoded as JSON, which may contain comments and trailing commas.
 func ReadConfig(configPath string) (*Config, error) {
-	// #nosec G304
-	f, err := os.Open(configPath)
+	doc, err := readDocument(configPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, err
 	}
-	defer func() { _ = f.Close() }()
-	var config Config
-	dec := json.NewDecoder(f)
-	dec.DisallowUnknownFields()
-	if err = dec.Decode(&config); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal JSON config: %w", err)
+	config, err := resolveIncludes(doc, nil)
+	if err != nil {
+		return nil, err
 	}
-	if err = config.validate(); err != nil {
+	if err = config.Validate(); err != nil {
 		return nil, fmt.Errorf("config validation failed: %w", err)
 	}
 	if err = config.setDefaults(); err != nil {
 		return nil, fmt.Errorf("failed to set default values: %w", err)
 	}
 	config.path = configPath
-	return &config, nil
+	config.format = doc.format
+	return config, nil
 }
 
-func (c *Config) Save() error {
-	f, err := os.Create(c.path)
-	if err != nil {
-		return fmt.Errorf("failed to open/create config file: %w", err)
+// New creates a [Config] for the root and synchronized repositories, which is saved under the provided path.
+// Unlike [ReadConfig], it does not validate the config, call [Config.Validate] once it's complete.
+func New(path string, root *Repository, repos []*Repository) (*Config, error) {
+	config := &Config{
+		Root:         root,
+		Repositories: repos,
+		path:         path,
+		format:       detectFormat(path),
 	}
-	enc := json.NewEncoder(f)
-	enc.SetIndent("", "  ")
-	enc.SetEscapeHTML(false)
-	if err = enc.Encode(c); err != nil {
-		return fmt.Errorf("failed to save config: %w", err)
+	config.document = config
+	if err := config.setDefaults(); err != nil {
+		return nil, fmt.Errorf("failed to set default values: %w", err)
 	}
-	return nil
+	return config, nil
+}
+
+// AddDiscoveredRepositories merges the repositories resolved from [Config.Discover] queries
+// with the explicitly defined ones and returns those which were added.
+// Repositories which have the same name or URL as an already defined repository are skipped.
+// Discovered repositories are never saved to the config file.
+func (c *Config) AddDiscoveredRepositories(repos []*Repository) []*Repository {
+	added := make([]*Repository, 0, len(repos))
+	for _, repo := range repos {
+		if slices.ContainsFunc(append(slices.Clone(c.Repositories), c.Root), func(r *Repository) bool {
+			return r.Name == repo.Name || r.URL == repo.URL
+		}) {
+			continue
+		}
+		repo.discovered = true
+		c.setRepositoryDefaults(repo)
+		c.Repositories = append(c.Repositories, repo)
+		added = append(added, repo)
+	}
+	return added
+}
+
+// AddIgnoredHunk adds the [diff.Hunk] to the ignore rule which applies specifically
+// to the repository and file with the provided names.
+// If there's no such rule defined in the config file itself (rules from included configs are not modified),
+// a new one is created.
+func (c *Config) AddIgnoredHunk(repo *Repository, fileName string, hunk diff.Hunk) {
+	for _, ignore := range c.document.Ignore {
+		if ignore.RepositoryName != nil && *ignore.RepositoryName == repo.Name &&
+			ignore.FileName != nil && *ignore.FileName == fileName &&
+			ignore.Matches(repo) {
+			ignore.Hunks = append(ignore.Hunks, hunk)
+			return
+		}
+	}
+	rule := &IgnoreRule{
+		RepositoryName: &repo.Name,
+		FileName:       &fileName,
+		Hunks:          []diff.Hunk{hunk},
+	}
+	c.document.Ignore = append(c.document.Ignore, rule)
+	c.Ignore = append(c.Ignore, rule)
 }
 
 func (c *Config) setDefaults() error {
@@ -109,7 +514,8 @@ func (c *Config) setDefaults() error {
 			c.resolvedStorePath = os.ExpandEnv(filepath.Join("$HOME", ".local", "share", "gitsync"))
 		}
 	} else {
-		c.resolvedStorePath = os.ExpandEnv(c.StorePath)
+		// Environment variables are already interpolated, expanding them again would break '$${' escapes.
+		c.resolvedStorePath = c.StorePath
 	}
 	if strings.HasPrefix(c.resolvedStorePath, "~") {
 		home, err := os.UserHomeDir()
@@ -119,71 +525,55 @@ func (c *Config) setDefaults() error {
 		c.resolvedStorePath = filepath.Join(home, c.resolvedStorePath[2:])
 	}
 	for _, repo := range c.Repositories {
-		repo.path = filepath.Join(c.GetStorePath(), repo.Name)
-		if repo.Ref == "" {
-			repo.defaultRef = defaultRef
-		}
-	}
-	c.Root.path = filepath.Join(c.GetStorePath(), c.Root.Name)
-	if c.Root.Ref == "" {
-		c.Root.defaultRef = defaultRef
+		c.setRepositoryDefaults(repo)
 	}
+	c.setRepositoryDefaults(c.Root)
 	return nil
 }
 
-func (c *Config) validate() error {
-	if len(c.Repositories) == 0 {
-		return errors.New("at least one repository is required")
-	}
-	if len(c.SyncFiles) == 0 {
-		return errors.New("at least one file to keep in sync is required")
-	}
-	unique := make(map[string]struct{})
-	for _, repo := range append(c.Repositories, c.Root) {
-		if _, ok := unique[repo.Name]; ok {
-			return fmt.Errorf("repository name '%s' is not unique", repo.Name)
-		} else {
-			unique[repo.Name] = struct{}{}
-		}
-		if repo.Name == "" {
-			return errors.New("repository name is required")
-		}
-		if repo.URL == "" {
-			return errors.New("repository URL is required")
-		}
+// hasHooks reports whether any hooks run in the repository's checkout,
+// either its own or of the files synchronized with it.
+// Hooks of all the files run in the root repository's checkout.
+func (c *Config) hasHooks(repo *Repository) bool {
+	if len(repo.Hooks) > 0 {
+		return true
 	}
-	unique = make(map[string]struct{})
-	for _, file := range c.SyncFiles {
-		if _, ok := unique[file.Name]; ok {
-			return fmt.Errorf("file name '%s' is not unique", file.Name)
-		} else {
-			unique[file.Name] = struct{}{}
-		}
-		if err := file.validate(); err != nil {
-			return fmt.Errorf("file %s validation failed: %w", file.Name, err)
-		}
-	}
-	for _, ignore := range c.Ignore {
-		if err := ignore.validate(); err != nil {
-			return fmt.Errorf("ignore rule validation failed: %w", err)
-		}
-	}
-	return nil
+	return slices.ContainsFunc(c.SyncFiles, func(f *File) bool {
+		return len(f.Hooks) > 0 && (repo == c.Root || f.Matches(repo))
+	})
 }
 
-func (f *File) validate() error {
-	if f.Name == "" {
-		return errors.New("file name is required")
+func (c *Config) setRepositoryDefaults(repo *Repository) {
+	repo.path = filepath.Join(c.GetStorePath(), repo.Name)
+	if repo.Ref == "" {
+		repo.defaultRef = defaultRef
 	}
-	if f.Path == "" {
-		return errors.New("file path is required")
+	switch {
+	case repo.Clone != nil:
+		repo.clone = *repo.Clone
+	case c.Clone != nil:
+		repo.clone = *c.Clone
 	}
-	return nil
-}
-
-func (i *IgnoreRule) validate() error {
-	if i.Regex == nil && i.Hunks == nil {
-		return errors.New("either 'regex' or 'hunk' needs to be defined")
+	if repo.clone.Sparse && c.hasHooks(repo) {
+		repo.clone.Sparse = false
 	}
-	return nil
+	repo.templates = Templates{}.override(c.Templates).override(repo.Templates)
+	switch {
+	case repo.PushStrategy != "":
+		repo.push = repo.PushStrategy
+	case c.PushStrategy != "":
+		repo.push = c.PushStrategy
+	default:
+		repo.push = PushStrategyForce
+	}
+	switch {
+	case repo.Delivery != "":
+		repo.delivery = repo.Delivery
+	case c.Delivery != "":
+		repo.delivery = c.Delivery
+	default:
+		repo.delivery = DeliveryPullRequest
+	}
+	repo.pr = PullRequestOptions{Assignees: []string{"@me"}}.override(c.PullRequest).override(repo.PullRequest)
+	repo.commit = CommitOptions{}.override(c.Commit).override(repo.Commit)
 }
@@ -4,9 +4,14 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/nieomylnieja/gitsync/internal/diff"
 )
 
 func TestReadmeExample(t *testing.T) {
@@ -18,25 +23,518 @@ func TestReadmeExample(t *testing.T) {
 	readJSON := false
 	jsonBuilder := bytes.Buffer{}
 	for scan.Scan() {
-		line := strings.TrimSpace(scan.Text())
-		switch {
-		case line == "```json5":
+		line := scan.Text()
+		switch strings.TrimSpace(line) {
+		case "```json5":
 			readJSON = true
-		case line == "```":
+		case "```":
 			readJSON = false
-		case readJSON && !strings.HasPrefix(line, "//"):
-			jsonBuilder.WriteString(line)
-			jsonBuilder.WriteString("\n")
+		default:
+			if readJSON {
+				jsonBuilder.WriteString(line)
+				jsonBuilder.WriteString("\n")
+			}
 		}
 	}
 	if err = scan.Err(); err != nil {
 		t.Fatal(err, "failed to scan README.md contents")
 	}
 	var config Config
-	if err = json.Unmarshal(jsonBuilder.Bytes(), &config); err != nil {
+	if err = formatJSON.decode(jsonBuilder.Bytes(), &config); err != nil {
 		t.Fatal(err, "failed to unmarshal JSON config")
 	}
-	if err = config.validate(); err != nil {
+	if err = config.Validate(); err != nil {
 		t.Fatal(err, "config validation failed")
 	}
 }
+
+func TestSelectorMatches(t *testing.T) {
+	repo := &Repository{Name: "go-libyear", Tags: []string{"library"}}
+	tests := map[string]struct {
+		selector Selector
+		matches  bool
+	}{
+		"empty selector":        {selector: Selector{}, matches: true},
+		"repository name":       {selector: Selector{Repositories: []string{"go-libyear"}}, matches: true},
+		"other repository name": {selector: Selector{Repositories: []string{"gitsync"}}, matches: false},
+		"tag":                   {selector: Selector{Tags: []string{"cli", "library"}}, matches: true},
+		"other tag":             {selector: Selector{Tags: []string{"cli"}}, matches: false},
+		"name or tag": {
+			selector: Selector{Repositories: []string{"gitsync"}, Tags: []string{"library"}},
+			matches:  true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if matches := test.selector.Matches(repo); matches != test.matches {
+				t.Errorf("expected %t, got %t", test.matches, matches)
+			}
+		})
+	}
+}
+
+func TestReadConfig_YAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `# Shared development files.
+root:
+  name: template
+  url: https://github.com/nieomylnieja/go-repo-template.git
+syncRepositories:
+  - name: go-libyear # Library.
+    url: https://github.com/nieomylnieja/go-libyear.git
+syncFiles:
+  - name: golangci linter config
+    path: .golangci.yml
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := ReadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Repositories[0].Name != "go-libyear" {
+		t.Fatalf("unexpected repository name: %s", config.Repositories[0].Name)
+	}
+	config.AddIgnoredHunk(config.Repositories[0], "golangci linter config", diff.Hunk{Changes: []string{"+version: 2"}})
+	if err = config.Save(); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"# Shared development files.", "# Library.", "+version: 2"} {
+		if !strings.Contains(string(saved), expected) {
+			t.Errorf("expected saved config to contain %q, got:\n%s", expected, saved)
+		}
+	}
+}
+
+func TestConfigSave_YAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `root:
+  name: template
+  url: https://github.com/nieomylnieja/go-repo-template.git
+syncRepositories:
+  - name: go-libyear
+    url: https://github.com/nieomylnieja/go-libyear.git
+syncFiles:
+  - name: golangci linter config
+    path: .golangci.yml
+ignore:
+  - regex: ["^a"] # rx
+# foot
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := ReadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, change := range []string{"+version: 2", "+version: 3"} {
+		config.AddIgnoredHunk(config.Repositories[0], "golangci linter config", diff.Hunk{Changes: []string{change}})
+		if err = config.Save(); err != nil {
+			t.Fatal(err)
+		}
+		saved, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := strings.Replace(data, "# rx\n", `# rx
+  - repositoryName: go-libyear
+    fileName: golangci linter config
+    hunks:
+      - changes:
+          - '+version: 2'
+`, 1)
+		if change == "+version: 3" {
+			expected = strings.Replace(expected, "'+version: 2'\n", `'+version: 2'
+      - changes:
+          - '+version: 3'
+`, 1)
+		}
+		if string(saved) != expected {
+			t.Errorf("expected saved config:\n%s\ngot:\n%s", expected, saved)
+		}
+	}
+}
+
+func TestReadConfig_CloneOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `root:
+  name: template
+  url: https://github.com/nieomylnieja/go-repo-template.git
+clone:
+  depth: 1
+  sparse: true
+syncRepositories:
+  - name: go-libyear
+    url: https://github.com/nieomylnieja/go-libyear.git
+  - name: monorepo
+    url: https://github.com/nieomylnieja/monorepo.git
+    clone:
+      filter: blob:none
+  - name: go-playground
+    url: https://github.com/nieomylnieja/go-playground.git
+    hooks: [go mod tidy]
+syncFiles:
+  - name: golangci linter config
+    path: .golangci.yml
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := ReadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]CloneOptions{
+		"template":   {Depth: 1, Sparse: true},
+		"go-libyear": {Depth: 1, Sparse: true},
+		"monorepo":   {Filter: "blob:none"},
+		// Hooks need the whole repository.
+		"go-playground": {Depth: 1},
+	}
+	for _, repo := range append(config.Repositories, config.Root) {
+		if actual := repo.GetCloneOptions(); actual != expected[repo.Name] {
+			t.Errorf("%s: expected clone options %+v, got %+v", repo.Name, expected[repo.Name], actual)
+		}
+	}
+}
+
+func TestStripJSONComments(t *testing.T) {
+	data := `{
+  // Line comment.
+  "url": "https://github.com/nieomylnieja/gitsync.git", /* Block comment. */
+  "regex": ["// not a comment", "\"/*",],
+}`
+	var v struct {
+		URL   string   `json:"url"`
+		Regex []string `json:"regex"`
+	}
+	stripped := stripJSONComments([]byte(data))
+	if len(stripped) != len(data) {
+		t.Fatalf("expected stripped data length to equal %d, got %d", len(data), len(stripped))
+	}
+	if err := json.Unmarshal(stripped, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.URL != "https://github.com/nieomylnieja/gitsync.git" {
+		t.Errorf("unexpected url: %s", v.URL)
+	}
+	if len(v.Regex) != 2 || v.Regex[0] != "// not a comment" || v.Regex[1] != `"/*` {
+		t.Errorf("unexpected regex: %v", v.Regex)
+	}
+}
+
+func TestConfigSave_JSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{
+  // Shared development files.
+  "root": {"name": "template", "url": "https://github.com/nieomylnieja/go-repo-template.git"},
+  "syncRepositories": [
+    // Library.
+    {"name": "go-libyear", "url": "https://github.com/nieomylnieja/go-libyear.git"},
+  ],
+  "syncFiles": [{"name": "golangci linter config", "path": ".golangci.yml"}],
+}
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := ReadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = config.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(path + ".bak"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected unchanged config not to be saved, got: %v", err)
+	}
+	config.AddIgnoredHunk(config.Repositories[0], "golangci linter config", diff.Hunk{
+		Lines:   "@@ -1 +1 @@",
+		Changes: []string{"+<version>"},
+	})
+	if err = config.Save(); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Replace(data, "}],\n}", `}],
+  "ignore": [
+    {
+      "repositoryName": "go-libyear",
+      "fileName": "golangci linter config",
+      "hunks": [
+        {
+          "lines": "@@ -1 +1 @@",
+          "changes": [
+            "+<version>"
+          ]
+        }
+      ]
+    }
+  ],
+}`, 1)
+	if string(saved) != expected {
+		t.Errorf("expected saved config:\n%s\ngot:\n%s", expected, saved)
+	}
+	backup, err := os.ReadFile(path + ".bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(backup) != data {
+		t.Errorf("expected backup to contain the previous config version, got:\n%s", backup)
+	}
+	if _, err = ReadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadConfig_Include(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, data string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	writeFile("shared/base.yaml", `
+storePath: /tmp/base
+root:
+  name: template
+  url: https://github.com/nieomylnieja/go-repo-template.git
+syncFiles:
+  - name: golangci linter config
+    path: .golangci.yml
+ignore:
+  - regex: ["^version:"]
+`)
+	teamConfig := `{
+  "include": ["shared/base.yaml"],
+  "storePath": "/tmp/team",
+  "syncRepositories": [{"name": "go-libyear", "url": "https://github.com/nieomylnieja/go-libyear.git"}],
+}
+`
+	path := writeFile("team.json", teamConfig)
+
+	config, err := ReadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.StorePath != "/tmp/team" {
+		t.Errorf("expected including config to take precedence, got store path: %s", config.StorePath)
+	}
+	if config.Root == nil || config.Root.Name != "template" {
+		t.Errorf("expected root repository to be included, got: %v", config.Root)
+	}
+	if len(config.SyncFiles) != 1 || len(config.Ignore) != 1 || len(config.Repositories) != 1 {
+		t.Fatalf("expected lists to be merged, got: %v", config)
+	}
+	config.AddIgnoredHunk(config.Repositories[0], "golangci linter config", diff.Hunk{Changes: []string{"+version: 2"}})
+	if err = config.Save(); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(saved), "^version:") || strings.Contains(string(saved), "syncFiles") {
+		t.Errorf("expected included entities not to be saved, got:\n%s", saved)
+	}
+
+	t.Run("duplicate names", func(t *testing.T) {
+		path := writeFile("duplicate.json", `{
+  "include": ["shared/base.yaml"],
+  "syncRepositories": [{"name": "go-libyear", "url": "https://github.com/nieomylnieja/go-libyear.git"}],
+  "syncFiles": [{"name": "golangci linter config", "path": ".golangci.yaml"}]
+}`)
+		_, err := ReadConfig(path)
+		if err == nil || !strings.Contains(err.Error(), "base.yaml and "+path) {
+			t.Errorf("expected duplicate file name error pointing to both configs, got: %v", err)
+		}
+	})
+	t.Run("cycle", func(t *testing.T) {
+		path := writeFile("cycle.json", `{"include": ["cycle.json"]}`)
+		_, err := ReadConfig(path)
+		if err == nil || !strings.Contains(err.Error(), "cycle") {
+			t.Errorf("expected include cycle error, got: %v", err)
+		}
+	})
+}
+
+func TestSchemaIsUpToDate(t *testing.T) {
+	shipped, err := os.ReadFile("../../config.schema.json")
+	if err != nil {
+		t.Fatal(err, "failed to read config.schema.json")
+	}
+	generated, err := Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(shipped, generated) {
+		t.Error("config.schema.json is outdated, run 'make generate' to update it")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	data := `{
+  "root": {"name": "template", "url": "https://github.com/nieomylnieja/go-repo-template.git", "delivery": "lcoal"},
+  "ignore": [
+    {"repositoryName": "go-libyer", "regex": ["^\\s\\+version:", "[:space:"]},
+    {"fileName": "goreleaser config"}
+  ],
+  "syncRepositories": [
+    {"name": "go-libyear", "url": "https://github.com/nieomylnieja/go-libyear.git"},
+    {"name": "go-libyear-fork", "url": "https://github.com/nieomylnieja/go-libyear.git"},
+    {"name": "template", "url": ""},
+    {"name": "gitlab", "url": "https://gitlab.com"}
+  ],
+  "syncFiles": [{"name": "golangci linter config", "path": ".golangci.yml", "repositories": ["gitsync"]}]
+}`
+	var config Config
+	if err := formatJSON.decode([]byte(data), &config); err != nil {
+		t.Fatal(err)
+	}
+	err := config.Validate()
+	var validationErrs ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		t.Fatalf("expected %T, got: %v", validationErrs, err)
+	}
+	expected := []string{
+		"$.root.delivery: delivery must be either 'pr', 'push' or 'local', got 'lcoal'",
+		"$.syncRepositories[1].url: repository URL 'https://github.com/nieomylnieja/go-libyear.git' " +
+			"is already used by 'go-libyear' repository",
+		"$.syncRepositories[2].name: repository name 'template' is not unique",
+		"$.syncRepositories[2].url: repository URL is required",
+		"$.syncRepositories[3].url: repository URL has no repository name: https://gitlab.com",
+		"$.syncFiles[0].repositories[0]: selected repository 'gitsync' is not defined in 'syncRepositories'",
+		"$.ignore[0].repositoryName: repository 'go-libyer' is not defined in 'syncRepositories'",
+		"$.ignore[0].regex[1]: invalid regular expression: unmatched '['",
+		"$.ignore[1]: either 'regex' or 'hunks' needs to be defined",
+		"$.ignore[1].fileName: file 'goreleaser config' is not defined in 'syncFiles'",
+	}
+	if len(validationErrs) != len(expected) {
+		t.Fatalf("expected %d errors, got %d:\n%s", len(expected), len(validationErrs), validationErrs)
+	}
+	for i := range expected {
+		if validationErrs[i].Error() != expected[i] {
+			t.Errorf("expected error %q, got %q", expected[i], validationErrs[i].Error())
+		}
+	}
+}
+
+func TestTranslateBasicRegex(t *testing.T) {
+	tests := map[string]string{
+		`^\s\+local-prefixes:`:  `^\s+local-prefixes:`,
+		`a+b?(c){1}|d`:          `a\+b\?\(c\)\{1\}\|d`,
+		`\(foo\|bar\)$`:         `(foo|bar)$`,
+		`*a^b$c`:                `\*a\^b\$c`,
+		`\<word\>`:              `\bword\b`,
+		`[[:space:]]*[]a-z]\+$`: `[[:space:]]*[]a-z]+$`,
+	}
+	for expr, expected := range tests {
+		translated, err := translateBasicRegex(expr)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", expr, err)
+			continue
+		}
+		if translated != expected {
+			t.Errorf("%s: expected %s, got %s", expr, expected, translated)
+		}
+	}
+}
+
+func TestInterpolateEnv(t *testing.T) {
+	t.Setenv("GITSYNC_OWNER", "nieomylnieja")
+	t.Setenv("GITSYNC_EMPTY", "")
+	tests := map[string]struct {
+		input    string
+		expected string
+		err      string
+	}{
+		"no references": {input: "^version$", expected: "^version$"},
+		"variable": {
+			input:    "https://github.com/${GITSYNC_OWNER}/gitsync.git",
+			expected: "https://github.com/nieomylnieja/gitsync.git",
+		},
+		"unset variable":   {input: "${GITSYNC_UNSET}", expected: ""},
+		"default":          {input: "${GITSYNC_EMPTY:-origin/main}", expected: "origin/main"},
+		"default not used": {input: "${GITSYNC_OWNER:-someone}", expected: "nieomylnieja"},
+		"escaped":          {input: "$${GITSYNC_OWNER} $HOME", expected: "${GITSYNC_OWNER} $HOME"},
+		"required": {
+			input: "${GITSYNC_UNSET:?token must be set}",
+			err:   "environment variable GITSYNC_UNSET: token must be set",
+		},
+		"unterminated": {input: "${GITSYNC_OWNER", err: "unterminated environment variable reference: ${GITSYNC_OWNER"},
+		"invalid name": {input: "${GITSYNC-OWNER}", err: "invalid environment variable reference: ${GITSYNC-OWNER}"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			result, err := interpolateEnv(test.input)
+			switch {
+			case test.err != "" && (err == nil || err.Error() != test.err):
+				t.Errorf("expected error %q, got: %v", test.err, err)
+			case test.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case result != test.expected:
+				t.Errorf("expected %q, got %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestReadConfig_InterpolateEnv(t *testing.T) {
+	t.Setenv("GITSYNC_OWNER", "nieomylnieja")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `storePath: /tmp/${GITSYNC_OWNER}/$${GITSYNC_OWNER}
+root:
+  name: template
+  url: https://github.com/${GITSYNC_OWNER}/go-repo-template.git
+ignore:
+  - regex: ["^\\s\\+token: ${{ github.token }}"]
+syncRepositories:
+  - name: go-libyear
+    url: https://github.com/${GITSYNC_OWNER}/go-libyear.git
+    ref: ${GITSYNC_REF:?ref is required}
+syncFiles:
+  - name: golangci linter config
+    path: .golangci.yml
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := ReadConfig(path)
+	var validationErrs ValidationErrors
+	if !errors.As(err, &validationErrs) || len(validationErrs) != 1 ||
+		validationErrs[0].Path != "$.syncRepositories[0].ref" {
+		t.Fatalf("expected required environment variable error, got: %v", err)
+	}
+	t.Setenv("GITSYNC_REF", "origin/dev")
+	config, err := ReadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Root.URL != "https://github.com/nieomylnieja/go-repo-template.git" {
+		t.Errorf("unexpected root URL: %s", config.Root.URL)
+	}
+	if config.GetStorePath() != "/tmp/nieomylnieja/${GITSYNC_OWNER}" {
+		t.Errorf("expected escaped reference to be kept in store path, got: %s", config.GetStorePath())
+	}
+	if config.Repositories[0].GetRef() != "origin/dev" {
+		t.Errorf("unexpected ref: %s", config.Repositories[0].GetRef())
+	}
+	if config.Ignore[0].Regex[0] != `^\s\+token: ${{ github.token }}` {
+		t.Errorf("expected ignore rules not to be interpolated, got: %s", config.Ignore[0].Regex[0])
+	}
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+var envVarNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// interpolateEnv replaces environment variable references in the string.
+// The following forms are supported:
+//
+//   - ${VAR} - value of VAR, empty if it is not set.
+//   - ${VAR:-default} - value of VAR, default if it is not set or empty.
+//   - ${VAR:?message} - value of VAR, an error with the message is returned if it is not set or empty.
+//   - $${ - literal '${'.
+//
+// Any other use of '$', like '$HOME' or '$' regex anchor, is left intact.
+func interpolateEnv(s string) (string, error) {
+	var sb strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start == -1 {
+			sb.WriteString(s)
+			return sb.String(), nil
+		}
+		if start > 0 && s[start-1] == '$' {
+			sb.WriteString(s[:start])
+			sb.WriteString("{")
+			s = s[start+2:]
+			continue
+		}
+		sb.WriteString(s[:start])
+		end := strings.IndexByte(s[start:], '}')
+		if end == -1 {
+			return "", fmt.Errorf("unterminated environment variable reference: %s", s[start:])
+		}
+		value, err := resolveEnvReference(s[start+2 : start+end])
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(value)
+		s = s[start+end+1:]
+	}
+}
+
+func resolveEnvReference(ref string) (string, error) {
+	name, operand, operator := ref, "", ""
+	if i := strings.Index(ref, ":"); i != -1 && i+1 < len(ref) && (ref[i+1] == '-' || ref[i+1] == '?') {
+		name, operator, operand = ref[:i], ref[i:i+2], ref[i+2:]
+	}
+	if !envVarNameRegex.MatchString(name) {
+		return "", fmt.Errorf("invalid environment variable reference: ${%s}", ref)
+	}
+	value := os.Getenv(name)
+	if value != "" {
+		return value, nil
+	}
+	switch operator {
+	case ":-":
+		return operand, nil
+	case ":?":
+		if operand == "" {
+			operand = "required but not set"
+		}
+		return "", fmt.Errorf("environment variable %s: %s", name, operand)
+	default:
+		return value, nil
+	}
+}
+
+// interpolateConfigEnv interpolates environment variables in every string field of the [Config],
+// except for the fields tagged with `env:"-"`.
+func interpolateConfigEnv(c *Config) error {
+	var errs ValidationErrors
+	interpolateValue(reflect.ValueOf(c).Elem(), "$", func(path string, err error) {
+		errs = append(errs, ValidationError{Source: c.path, Path: path, Message: err.Error()})
+	})
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func interpolateValue(v reflect.Value, path string, onError func(path string, err error)) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			interpolateValue(v.Elem(), path, onError)
+		}
+	case reflect.String:
+		interpolated, err := interpolateEnv(v.String())
+		if err != nil {
+			onError(path, err)
+			return
+		}
+		v.SetString(interpolated)
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			interpolateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), onError)
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String {
+			return
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			interpolated, err := interpolateEnv(iter.Value().String())
+			if err != nil {
+				onError(fmt.Sprintf("%s.%s", path, iter.Key()), err)
+				continue
+			}
+			v.SetMapIndex(iter.Key(), reflect.ValueOf(interpolated))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() || field.Tag.Get("env") == "-" {
+				continue
+			}
+			fieldPath := path
+			if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" {
+				fieldPath = path + "." + name
+			} else if !field.Anonymous {
+				fieldPath = path + "." + field.Name
+			}
+			interpolateValue(v.Field(i), fieldPath, onError)
+		}
+	}
+}
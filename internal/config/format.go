@@ -0,0 +1,136 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// format is the encoding of the config file, detected from its extension.
+type format int
+
+const (
+	// formatJSON is a JSON document which may also contain comments and trailing commas.
+	formatJSON format = iota
+	formatYAML
+)
+
+func detectFormat(path string) format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return formatYAML
+	default:
+		return formatJSON
+	}
+}
+
+func (f format) String() string {
+	switch f {
+	case formatYAML:
+		return "YAML"
+	default:
+		return "JSON"
+	}
+}
+
+// decode strictly decodes the data into v, unknown fields result in an error.
+func (f format) decode(data []byte, v any) error {
+	switch f {
+	case formatYAML:
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(v); err != nil {
+			if errors.Is(err, io.EOF) {
+				return errors.New("config file is empty")
+			}
+			return err
+		}
+		return nil
+	default:
+		dec := json.NewDecoder(bytes.NewReader(stripJSONComments(data)))
+		dec.DisallowUnknownFields()
+		return dec.Decode(v)
+	}
+}
+
+// encode encodes v into the format.
+func (f format) encode(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	switch f {
+	case formatYAML:
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// stripJSONComments replaces line (//) and block (/* */) comments and trailing commas
+// found outside of JSON strings with whitespace.
+// Byte offsets and line numbers of the remaining content are preserved.
+func stripJSONComments(data []byte) []byte {
+	out := bytes.Clone(data)
+	blank := func(from, to int) {
+		for i := from; i < to && i < len(out); i++ {
+			if out[i] != '\n' {
+				out[i] = ' '
+			}
+		}
+	}
+	lastComma := -1
+	for i := 0; i < len(out); i++ {
+		switch c := out[i]; {
+		case c == '"':
+			lastComma = -1
+			for i++; i < len(out) && out[i] != '"'; i++ {
+				if out[i] == '\\' {
+					i++
+				}
+			}
+		case c == '/' && i+1 < len(out) && out[i+1] == '/':
+			end := bytes.IndexByte(out[i:], '\n')
+			if end == -1 {
+				end = len(out) - i
+			}
+			blank(i, i+end)
+			i += end - 1
+		case c == '/' && i+1 < len(out) && out[i+1] == '*':
+			end := bytes.Index(out[i+2:], []byte("*/"))
+			if end == -1 {
+				end = len(out) - i
+			} else {
+				end += 4
+			}
+			blank(i, i+end)
+			i += end - 1
+		case c == ',':
+			lastComma = i
+		case c == '}' || c == ']':
+			if lastComma != -1 {
+				blank(lastComma, lastComma+1)
+			}
+			lastComma = -1
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+		default:
+			lastComma = -1
+		}
+	}
+	return out
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// readDocument reads and decodes a single config file, without resolving its includes.
+func readDocument(path string) (*Config, error) {
+	// #nosec G304
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	doc := &Config{
+		path:   path,
+		format: detectFormat(path),
+		raw:    data,
+	}
+	if err = doc.format.decode(data, doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s config %s: %w", doc.format, path, err)
+	}
+	if err = interpolateConfigEnv(doc); err != nil {
+		return nil, fmt.Errorf("failed to interpolate environment variables in config %s: %w", path, err)
+	}
+	if doc.snapshot, err = topLevelValues(doc); err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	return doc, nil
+}
+
+// resolveIncludes merges the document with the configs it includes.
+//
+// Included configs are merged in the order they are listed, each of them first resolving its own includes.
+// The including document is merged last.
+// Scalar values, like 'storePath', 'root', 'clone' or 'templates', defined by a config which is merged later
+// take precedence.
+// Lists, like 'syncRepositories', 'discover', 'syncFiles' and 'ignore', are concatenated.
+//
+// Included paths are relative to the directory of the including config.
+func resolveIncludes(doc *Config, chain []string) (*Config, error) {
+	absPath, err := filepath.Abs(doc.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve config path: %w", err)
+	}
+	if slices.Contains(chain, absPath) {
+		return nil, fmt.Errorf("config include cycle detected: %s", strings.Join(append(chain, absPath), " -> "))
+	}
+	chain = append(chain, absPath)
+	merged := &Config{origins: make(map[any]string)}
+	for _, include := range doc.Include {
+		path := include
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(doc.path), path)
+		}
+		included, err := readDocument(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to include config: %w", err)
+		}
+		resolved, err := resolveIncludes(included, chain)
+		if err != nil {
+			return nil, err
+		}
+		merged.merge(resolved)
+	}
+	merged.merge(doc)
+	merged.Include = doc.Include
+	merged.document = doc
+	return merged, nil
+}
+
+// merge overlays the other [Config] on top of the receiver.
+func (c *Config) merge(other *Config) {
+	if other.StorePath != "" {
+		c.StorePath = other.StorePath
+	}
+	if other.Root != nil {
+		c.Root = other.Root
+	}
+	if other.Clone != nil {
+		c.Clone = other.Clone
+	}
+	if other.Templates != nil {
+		c.Templates = other.Templates
+	}
+	if other.PushStrategy != "" {
+		c.PushStrategy = other.PushStrategy
+	}
+	if other.Delivery != "" {
+		c.Delivery = other.Delivery
+	}
+	if other.PullRequest != nil {
+		c.PullRequest = other.PullRequest
+	}
+	if other.Commit != nil {
+		c.Commit = other.Commit
+	}
+	c.Repositories = append(c.Repositories, other.Repositories...)
+	c.Discover = append(c.Discover, other.Discover...)
+	c.SyncFiles = append(c.SyncFiles, other.SyncFiles...)
+	c.Ignore = append(c.Ignore, other.Ignore...)
+	if other.origins != nil {
+		for entity, origin := range other.origins {
+			c.origins[entity] = origin
+		}
+		return
+	}
+	if other.Root != nil {
+		c.origins[other.Root] = other.path
+	}
+	for _, repo := range other.Repositories {
+		c.origins[repo] = other.path
+	}
+	for _, discovery := range other.Discover {
+		c.origins[discovery] = other.path
+	}
+	for _, file := range other.SyncFiles {
+		c.origins[file] = other.path
+	}
+	for _, ignore := range other.Ignore {
+		c.origins[ignore] = other.path
+	}
+}
+
+// describeDuplicate returns a hint pointing to the config files which defined
+// the duplicated entities if they were defined in different files.
+func (c *Config) describeDuplicate(first, second any) string {
+	firstOrigin, secondOrigin := c.origins[first], c.origins[second]
+	if firstOrigin == secondOrigin {
+		return ""
+	}
+	return fmt.Sprintf(" (defined in %s and %s)", firstOrigin, secondOrigin)
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// validateBasicRegex checks if the expression is a valid POSIX basic regular expression (BRE),
+// as interpreted by GNU diff '-I' option.
+// The expression is translated into an equivalent RE2 syntax and compiled with [regexp.Compile].
+func validateBasicRegex(expr string) error {
+	translated, err := translateBasicRegex(expr)
+	if err != nil {
+		return err
+	}
+	_, err = regexp.Compile(translated)
+	return err
+}
+
+// translateBasicRegex translates GNU BRE syntax into RE2 syntax.
+// In BRE '+', '?', '|', '(', ')', '{' and '}' are literals, unless escaped with a backslash,
+// '*' is a literal at the start of an expression, '^' is an anchor only at the start of an expression
+// and '$' only at its end.
+func translateBasicRegex(expr string) (string, error) {
+	var sb strings.Builder
+	// atExprStart is true at the start of the whole expression, a group or an alternative.
+	atExprStart := true
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		wasExprStart := atExprStart
+		atExprStart = false
+		switch c {
+		case '\\':
+			if i+1 == len(expr) {
+				return "", errors.New("trailing backslash (\\)")
+			}
+			i++
+			switch next := expr[i]; next {
+			case '+', '?', '{', '}', ')':
+				sb.WriteByte(next)
+			case '(', '|':
+				sb.WriteByte(next)
+				atExprStart = true
+			case '<', '>':
+				sb.WriteString(`\b`)
+			case '1', '2', '3', '4', '5', '6', '7', '8', '9':
+				return "", errors.New("back-references are not supported")
+			default:
+				sb.WriteByte('\\')
+				sb.WriteByte(next)
+			}
+		case '+', '?', '|', '(', ')', '{', '}':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case '*':
+			if wasExprStart {
+				sb.WriteString(`\*`)
+			} else {
+				sb.WriteByte(c)
+			}
+		case '^':
+			if wasExprStart {
+				sb.WriteByte(c)
+				atExprStart = true
+			} else {
+				sb.WriteString(`\^`)
+			}
+		case '$':
+			if i+1 == len(expr) || strings.HasPrefix(expr[i+1:], `\)`) || strings.HasPrefix(expr[i+1:], `\|`) {
+				sb.WriteByte(c)
+			} else {
+				sb.WriteString(`\$`)
+			}
+		case '[':
+			end := bracketExpressionEnd(expr, i)
+			if end == -1 {
+				return "", errors.New("unmatched '['")
+			}
+			sb.WriteString(expr[i : end+1])
+			i = end
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String(), nil
+}
+
+// bracketExpressionEnd returns the index of ']' closing the bracket expression starting at the index,
+// or -1 if it's not closed.
+func bracketExpressionEnd(expr string, start int) int {
+	i := start + 1
+	if i < len(expr) && expr[i] == '^' {
+		i++
+	}
+	// ']' is a literal if it's the first character of the list.
+	if i < len(expr) && expr[i] == ']' {
+		i++
+	}
+	for ; i < len(expr); i++ {
+		switch {
+		case expr[i] == '[' && i+1 < len(expr) && strings.IndexByte(":.=", expr[i+1]) != -1:
+			// Character class, e.g. '[:space:]'.
+			closing := strings.Index(expr[i+2:], string(expr[i+1])+"]")
+			if closing == -1 {
+				return -1
+			}
+			i += closing + 3
+		case expr[i] == ']':
+			return i
+		}
+	}
+	return -1
+}
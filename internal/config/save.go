@@ -0,0 +1,511 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Save writes the config back to its file in the format it was read in.
+// The file is only written if the config has changed since it was read.
+// Only the top-level keys whose values have changed are rewritten,
+// the rest of the original document, including comments, is left intact.
+// The previous version of the file is kept next to it with a '.bak' suffix.
+//
+// Entities defined in included config files are not written to the file.
+func (c *Config) Save() error {
+	return c.document.save()
+}
+
+func (c *Config) save() error {
+	values, err := topLevelValues(c)
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	changes := make(map[string]json.RawMessage)
+	for key, value := range values {
+		if original, ok := c.snapshot[key]; !ok || !bytes.Equal(original, value) {
+			changes[key] = value
+		}
+	}
+	for key := range c.snapshot {
+		if _, ok := values[key]; !ok {
+			changes[key] = nil
+		}
+	}
+	if c.raw != nil && len(changes) == 0 {
+		return nil
+	}
+	var data []byte
+	switch {
+	case c.raw == nil:
+		data, err = c.format.encode(c)
+	case c.format == formatYAML:
+		data, err = patchYAMLDocument(c.raw, changes)
+	default:
+		data, err = patchJSONDocument(c.raw, changes)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	if err = writeFileAtomic(c.path, data); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	c.raw = data
+	c.snapshot = values
+	return nil
+}
+
+// topLevelValues returns compact JSON encoded values of the config keyed by their top-level names.
+func topLevelValues(c *Config) (map[string]json.RawMessage, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(c); err != nil {
+		return nil, err
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(buf.Bytes(), &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// jsonMember describes the location of a top-level object member in a JSON document.
+type jsonMember struct {
+	key        string
+	keyStart   int
+	valueStart int
+	valueEnd   int
+}
+
+// patchJSONDocument replaces the values of changed top-level keys in the original JSON document.
+// Keys with nil values are removed and keys which are not present in the document are appended.
+func patchJSONDocument(original []byte, changes map[string]json.RawMessage) ([]byte, error) {
+	stripped := stripJSONComments(original)
+	members, err := findJSONMembers(stripped)
+	if err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return nil, errors.New("config document has no top-level keys")
+	}
+	indent := lineIndent(original, members[0].keyStart)
+	type edit struct {
+		start, end int
+		text       string
+	}
+	edits := make([]edit, 0, len(changes))
+	for i, member := range members {
+		value, ok := changes[member.key]
+		if !ok {
+			continue
+		}
+		delete(changes, member.key)
+		if value == nil {
+			start, end := member.keyStart, member.valueEnd
+			switch {
+			case i > 0:
+				start = members[i-1].valueEnd
+			case i+1 < len(members):
+				end = members[i+1].keyStart
+			}
+			edits = append(edits, edit{start: start, end: end})
+			continue
+		}
+		text, err := indentJSON(value, lineIndent(original, member.keyStart))
+		if err != nil {
+			return nil, err
+		}
+		edits = append(edits, edit{start: member.valueStart, end: member.valueEnd, text: text})
+	}
+	keys := make([]string, 0, len(changes))
+	for key, value := range changes {
+		if value != nil {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	var appended strings.Builder
+	for _, key := range keys {
+		text, err := indentJSON(changes[key], indent)
+		if err != nil {
+			return nil, err
+		}
+		encodedKey, _ := json.Marshal(key)
+		appended.WriteString(fmt.Sprintf(",\n%s%s: %s", indent, encodedKey, text))
+	}
+	if appended.Len() > 0 {
+		lastEnd := members[len(members)-1].valueEnd
+		edits = append(edits, edit{start: lastEnd, end: lastEnd, text: appended.String()})
+	}
+	slices.SortFunc(edits, func(a, b edit) int { return b.start - a.start })
+	result := bytes.Clone(original)
+	for _, e := range edits {
+		result = slices.Concat(result[:e.start], []byte(e.text), result[e.end:])
+	}
+	return result, nil
+}
+
+// findJSONMembers locates the top-level object members in a JSON document stripped of comments.
+func findJSONMembers(data []byte) ([]jsonMember, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, errors.New("config document must be a JSON object")
+	}
+	skip := func(offset int, chars string) int {
+		for offset < len(data) && strings.IndexByte(chars, data[offset]) != -1 {
+			offset++
+		}
+		return offset
+	}
+	var members []jsonMember
+	for dec.More() {
+		keyStart := skip(int(dec.InputOffset()), " \t\r\n,")
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected JSON token: %v", tok)
+		}
+		valueStart := skip(int(dec.InputOffset()), " \t\r\n:")
+		var value json.RawMessage
+		if err = dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		members = append(members, jsonMember{
+			key:        key,
+			keyStart:   keyStart,
+			valueStart: valueStart,
+			valueEnd:   int(dec.InputOffset()),
+		})
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// indentJSON formats the JSON value so that it can be placed in a line indented with the prefix.
+func indentJSON(value json.RawMessage, prefix string) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, value, prefix, "  "); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// lineIndent returns the leading whitespace of the line containing the offset.
+func lineIndent(data []byte, offset int) string {
+	lineStart := bytes.LastIndexByte(data[:offset], '\n') + 1
+	end := lineStart
+	for end < len(data) && (data[end] == ' ' || data[end] == '\t') {
+		end++
+	}
+	return string(data[lineStart:end])
+}
+
+// patchYAMLDocument replaces the values of changed top-level keys in the original YAML document.
+// Keys with nil values are removed and keys which are not present in the document are appended.
+// Each changed key is re-encoded from its original value merged with the new one,
+// the nodes which did not change keep their style and comments.
+func patchYAMLDocument(original []byte, changes map[string]json.RawMessage) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(original, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode || doc.Content[0].Style&yaml.FlowStyle != 0 {
+		return nil, errors.New("config document must be a YAML block mapping")
+	}
+	root := doc.Content[0]
+	lines := strings.SplitAfter(string(original), "\n")
+	type edit struct {
+		start, end int
+		text       string
+	}
+	edits := make([]edit, 0, len(changes))
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		keyNode, valueNode := root.Content[i], root.Content[i+1]
+		value, ok := changes[keyNode.Value]
+		if !ok {
+			continue
+		}
+		delete(changes, keyNode.Value)
+		start := keyNode.Line - 1
+		end := len(lines)
+		if i+2 < len(root.Content) {
+			end = root.Content[i+2].Line - 1
+		}
+		// Comments and blank lines preceding the next key belong to it.
+		for end > start+1 && isYAMLBlankOrComment(lines[end-1]) {
+			end--
+		}
+		// Trailing comments are kept in place, they must not be encoded again with the value.
+		clearYAMLFootComments(keyNode)
+		clearYAMLFootComments(valueNode)
+		if value == nil {
+			edits = append(edits, edit{start: start, end: end})
+			continue
+		}
+		text, err := encodeYAMLKey(keyNode, valueNode, value)
+		if err != nil {
+			return nil, err
+		}
+		edits = append(edits, edit{start: start, end: end, text: text})
+	}
+	keys := make([]string, 0, len(changes))
+	for key, value := range changes {
+		if value != nil {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	var appended strings.Builder
+	for _, key := range keys {
+		text, err := encodeYAMLKey(&yaml.Node{Kind: yaml.ScalarNode, Value: key}, nil, changes[key])
+		if err != nil {
+			return nil, err
+		}
+		appended.WriteString(text)
+	}
+	slices.SortFunc(edits, func(a, b edit) int { return b.start - a.start })
+	for _, e := range edits {
+		lines = slices.Concat(lines[:e.start], []string{e.text}, lines[e.end:])
+	}
+	result := strings.Join(lines, "")
+	if appended.Len() > 0 {
+		if result != "" && !strings.HasSuffix(result, "\n") {
+			result += "\n"
+		}
+		result += appended.String()
+	}
+	return []byte(result), nil
+}
+
+// encodeYAMLKey encodes a single top-level key with its new JSON encoded value.
+// If the original value node is provided, the new value is merged into it with [mergeYAMLNodes].
+func encodeYAMLKey(keyNode, originalValue *yaml.Node, value json.RawMessage) (string, error) {
+	var decoded any
+	if err := json.Unmarshal(value, &decoded); err != nil {
+		return "", err
+	}
+	var valueNode yaml.Node
+	if err := valueNode.Encode(decoded); err != nil {
+		return "", err
+	}
+	// Preserve the order of the keys as they're defined in the config structures.
+	if err := reorderYAMLMappings(&valueNode, value); err != nil {
+		return "", err
+	}
+	key := *keyNode
+	key.HeadComment = ""
+	mapping := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{&key, mergeYAMLNodes(originalValue, &valueNode)}}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(mapping); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// reorderYAMLMappings sorts the keys of the mapping nodes in the same order
+// as they appear in the JSON encoded value.
+// Decoding JSON into a map loses the keys order, which is restored here.
+func reorderYAMLMappings(node *yaml.Node, value json.RawMessage) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		dec := json.NewDecoder(bytes.NewReader(value))
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		order := make([]string, 0, len(node.Content)/2)
+		values := make(map[string]json.RawMessage, len(node.Content)/2)
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			var raw json.RawMessage
+			if err = dec.Decode(&raw); err != nil {
+				return err
+			}
+			key, _ := tok.(string)
+			order = append(order, key)
+			values[key] = raw
+		}
+		pairs := make([][2]*yaml.Node, 0, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if err := reorderYAMLMappings(node.Content[i+1], values[node.Content[i].Value]); err != nil {
+				return err
+			}
+			pairs = append(pairs, [2]*yaml.Node{node.Content[i], node.Content[i+1]})
+		}
+		slices.SortFunc(pairs, func(a, b [2]*yaml.Node) int {
+			return slices.Index(order, a[0].Value) - slices.Index(order, b[0].Value)
+		})
+		node.Content = node.Content[:0]
+		for _, pair := range pairs {
+			node.Content = append(node.Content, pair[0], pair[1])
+		}
+	case yaml.SequenceNode:
+		var items []json.RawMessage
+		if err := json.Unmarshal(value, &items); err != nil {
+			return err
+		}
+		for i := range node.Content {
+			if i < len(items) {
+				if err := reorderYAMLMappings(node.Content[i], items[i]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// mergeYAMLNodes returns the updated node tree with the unchanged parts of the original tree reused,
+// so that their style and comments are preserved.
+// Mapping entries are matched by their keys and sequence entries with [mergeYAMLSequences].
+func mergeYAMLNodes(original, updated *yaml.Node) *yaml.Node {
+	if original == nil || original.Kind != updated.Kind {
+		return updated
+	}
+	if equalYAMLNodes(original, updated) {
+		return original
+	}
+	merged := *updated
+	merged.HeadComment = original.HeadComment
+	merged.LineComment = original.LineComment
+	merged.FootComment = original.FootComment
+	if original.ShortTag() == updated.ShortTag() {
+		merged.Style = original.Style
+	}
+	switch merged.Kind {
+	case yaml.MappingNode:
+		merged.Content = make([]*yaml.Node, 0, len(updated.Content))
+		for i := 0; i+1 < len(updated.Content); i += 2 {
+			key, value := updated.Content[i], updated.Content[i+1]
+			var originalValue *yaml.Node
+			for j := 0; j+1 < len(original.Content); j += 2 {
+				if original.Content[j].Value == key.Value {
+					key, originalValue = original.Content[j], original.Content[j+1]
+					break
+				}
+			}
+			merged.Content = append(merged.Content, key, mergeYAMLNodes(originalValue, value))
+		}
+	case yaml.SequenceNode:
+		merged.Content = mergeYAMLSequences(original.Content, updated.Content)
+	}
+	return &merged
+}
+
+// mergeYAMLSequences matches the updated sequence entries with the original ones.
+// Equal entries are reused, original entries which are not found further in the updated sequence
+// are merged with the updated entry in their place and the remaining updated entries are new.
+func mergeYAMLSequences(original, updated []*yaml.Node) []*yaml.Node {
+	merged := make([]*yaml.Node, 0, len(updated))
+	next := 0
+	for i, node := range updated {
+		// Skip the original entries which were removed.
+		if j := slices.IndexFunc(original[next:], func(n *yaml.Node) bool {
+			return equalYAMLNodes(n, node)
+		}); j != -1 {
+			merged = append(merged, original[next+j])
+			next += j + 1
+			continue
+		}
+		if next < len(original) && !slices.ContainsFunc(updated[i+1:], func(n *yaml.Node) bool {
+			return equalYAMLNodes(original[next], n)
+		}) {
+			merged = append(merged, mergeYAMLNodes(original[next], node))
+			next++
+			continue
+		}
+		merged = append(merged, node)
+	}
+	return merged
+}
+
+// equalYAMLNodes reports whether the nodes decode to the same value.
+func equalYAMLNodes(a, b *yaml.Node) bool {
+	var decodedA, decodedB any
+	if a.Decode(&decodedA) != nil || b.Decode(&decodedB) != nil {
+		return false
+	}
+	encodedA, errA := json.Marshal(decodedA)
+	encodedB, errB := json.Marshal(decodedB)
+	return errA == nil && errB == nil && bytes.Equal(encodedA, encodedB)
+}
+
+// clearYAMLFootComments removes the foot comments placed after the node's content,
+// which belong to the node itself and to its last descendants.
+func clearYAMLFootComments(node *yaml.Node) {
+	for node != nil {
+		node.FootComment = ""
+		if len(node.Content) == 0 {
+			return
+		}
+		node = node.Content[len(node.Content)-1]
+	}
+}
+
+func isYAMLBlankOrComment(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" || strings.HasPrefix(trimmed, "#")
+}
+
+// writeFileAtomic writes the data to a temporary file in the same directory
+// and renames it to the destination path, keeping the previous version with a '.bak' suffix.
+func writeFileAtomic(path string, data []byte) error {
+	mode := fs.FileMode(0o600)
+	// #nosec G304
+	previous, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if info, err := os.Stat(path); err == nil {
+			mode = info.Mode().Perm()
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	if previous != nil {
+		if err = os.WriteFile(path+".bak", previous, mode); err != nil {
+			return fmt.Errorf("failed to back up previous config version: %w", err)
+		}
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+const schemaID = "https://raw.githubusercontent.com/nieomylnieja/gitsync/main/config.schema.json"
+
+// Schema returns the [JSON Schema] of the config file generated from the [Config] structure.
+// Fields which are not tagged with 'omitempty' are required, except for the top-level ones.
+//
+// [JSON Schema]: https://json-schema.org
+func Schema() ([]byte, error) {
+	gen := schemaGenerator{defs: make(map[string]any)}
+	root := gen.structSchema(reflect.TypeOf(Config{}))
+	// Included config files may define only some of the required fields,
+	// the requirements are verified for the merged config by 'config validate' command.
+	delete(root, "required")
+	root["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	root["$id"] = schemaID
+	root["title"] = "gitsync configuration"
+	root["$defs"] = gen.defs
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(root); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type schemaGenerator struct {
+	defs map[string]any
+}
+
+func (g schemaGenerator) typeSchema(typ reflect.Type) map[string]any {
+	switch typ.Kind() {
+	case reflect.Pointer:
+		return g.typeSchema(typ.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.typeSchema(typ.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.typeSchema(typ.Elem())}
+	case reflect.Struct:
+		if _, ok := g.defs[typ.Name()]; !ok {
+			// Register the definition before generating it to handle recursive types.
+			g.defs[typ.Name()] = nil
+			g.defs[typ.Name()] = g.structSchema(typ)
+		}
+		return map[string]any{"$ref": "#/$defs/" + typ.Name()}
+	default:
+		return map[string]any{}
+	}
+}
+
+func (g schemaGenerator) structSchema(typ reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	required := make([]string, 0)
+	var collect func(typ reflect.Type)
+	collect = func(typ reflect.Type) {
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			tag, hasTag := field.Tag.Lookup("json")
+			if field.Anonymous && !hasTag {
+				collect(field.Type)
+				continue
+			}
+			if !field.IsExported() || tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = g.typeSchema(field.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+	}
+	collect(typ)
+	schema := map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
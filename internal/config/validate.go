@@ -0,0 +1,314 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/nieomylnieja/gitsync/internal/giturl"
+)
+
+// ValidationError describes a single problem found in the config.
+type ValidationError struct {
+	// Source is the path of the config file which defines the invalid value.
+	// It is only set if the config includes other config files.
+	Source string
+	// Path is the JSON path of the invalid value within the config file, e.g. '$.syncRepositories[0].url'.
+	Path    string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	if e.Source != "" {
+		return fmt.Sprintf("%s: %s: %s", e.Source, e.Path, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ValidationErrors is a list of all the problems found in the config.
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Validate checks the config and returns [ValidationErrors] with every problem found.
+func (c *Config) Validate() error {
+	v := validator{config: c}
+	if c.Root == nil {
+		v.add(nil, "$.root", "root repository is required")
+	}
+	if len(c.Repositories) == 0 && len(c.Discover) == 0 {
+		v.add(nil, "$.syncRepositories",
+			"at least one repository is required, either in 'syncRepositories' or through 'discover'")
+	}
+	if len(c.SyncFiles) == 0 {
+		v.add(nil, "$.syncFiles", "at least one file to keep in sync is required")
+	}
+	repoNames := make(map[string]*Repository)
+	repoURLs := make(map[string]*Repository)
+	validateRepo := func(repo *Repository, path string) {
+		if repo.Name == "" {
+			v.add(repo, path+".name", "repository name is required")
+		} else if defined, ok := repoNames[repo.Name]; ok {
+			v.add(repo, path+".name", "repository name '%s' is not unique%s",
+				repo.Name, c.describeDuplicate(defined, repo))
+		} else {
+			repoNames[repo.Name] = repo
+		}
+		if repo.URL == "" {
+			v.add(repo, path+".url", "repository URL is required")
+		} else if defined, ok := repoURLs[repo.URL]; ok {
+			v.add(repo, path+".url", "repository URL '%s' is already used by '%s' repository",
+				repo.URL, defined.Name)
+		} else {
+			repoURLs[repo.URL] = repo
+			if _, err := giturl.Parse(repo.URL); err != nil {
+				v.add(repo, path+".url", "%v", err)
+			}
+		}
+	}
+	validateClone := func(entity any, clone *CloneOptions, path string) {
+		if clone != nil && clone.Depth < 0 {
+			v.add(entity, path+".depth", "depth must not be negative")
+		}
+	}
+	validateTemplates := func(entity any, templates *Templates, path string) {
+		if templates == nil {
+			return
+		}
+		for _, tpl := range []struct{ name, text string }{
+			{"branch", templates.Branch},
+			{"commitTitle", templates.CommitTitle},
+			{"commitBody", templates.CommitBody},
+			{"pullRequestTitle", templates.PullRequestTitle},
+			{"pullRequestBody", templates.PullRequestBody},
+		} {
+			if _, err := template.New(tpl.name).Parse(tpl.text); err != nil {
+				v.add(entity, path+"."+tpl.name, "invalid template: %v", err)
+			}
+		}
+	}
+	validatePushStrategy := func(entity any, strategy PushStrategy, path string) {
+		switch strategy {
+		case "", PushStrategyForce, PushStrategyAppend:
+		default:
+			v.add(entity, path, "push strategy must be either '%s' or '%s', got '%s'",
+				PushStrategyForce, PushStrategyAppend, strategy)
+		}
+	}
+	validateDelivery := func(entity any, delivery Delivery, path string) {
+		switch delivery {
+		case "", DeliveryPullRequest, DeliveryPush, DeliveryLocal:
+		default:
+			v.add(entity, path, "delivery must be either '%s', '%s' or '%s', got '%s'",
+				DeliveryPullRequest, DeliveryPush, DeliveryLocal, delivery)
+		}
+	}
+	validatePullRequest := func(entity any, pr *PullRequestOptions, path string) {
+		if pr == nil {
+			return
+		}
+		switch pr.AutoMerge {
+		case "", MergeMethodMerge, MergeMethodSquash, MergeMethodRebase:
+		default:
+			v.add(entity, path+".autoMerge", "auto-merge method must be either '%s', '%s' or '%s', got '%s'",
+				MergeMethodMerge, MergeMethodSquash, MergeMethodRebase, pr.AutoMerge)
+		}
+		for i, team := range pr.TeamReviewers {
+			if org, slug, found := strings.Cut(team, "/"); !found || org == "" || slug == "" {
+				v.add(entity, fmt.Sprintf("%s.teamReviewers[%d]", path, i),
+					"team reviewer must be in the 'organization/team' format, got '%s'", team)
+			}
+		}
+	}
+	validateCommit := func(entity any, commit *CommitOptions, path string) {
+		if commit == nil {
+			return
+		}
+		for _, identity := range []struct {
+			name     string
+			identity *CommitIdentity
+		}{
+			{"author", commit.Author},
+			{"committer", commit.Committer},
+		} {
+			if identity.identity == nil {
+				continue
+			}
+			if identity.identity.Name == "" {
+				v.add(entity, path+"."+identity.name+".name", "%s name is required", identity.name)
+			}
+			if identity.identity.Email == "" {
+				v.add(entity, path+"."+identity.name+".email", "%s email is required", identity.name)
+			}
+		}
+		if commit.Signing != nil {
+			switch commit.Signing.Format {
+			case "", SigningFormatGPG, SigningFormatSSH:
+			default:
+				v.add(entity, path+".signing.format", "signing format must be either '%s' or '%s', got '%s'",
+					SigningFormatGPG, SigningFormatSSH, commit.Signing.Format)
+			}
+		}
+		for i, trailer := range commit.Trailers {
+			if token, value, found := strings.Cut(trailer, ":"); !found ||
+				strings.TrimSpace(token) == "" || strings.TrimSpace(value) == "" {
+				v.add(entity, fmt.Sprintf("%s.trailers[%d]", path, i),
+					"trailer must be in the 'Token: value' format, got '%s'", trailer)
+			}
+		}
+	}
+	validateHooks := func(entity any, hooks []string, path string) {
+		for i, hook := range hooks {
+			if strings.TrimSpace(hook) == "" {
+				v.add(entity, fmt.Sprintf("%s.hooks[%d]", path, i), "hook command must not be empty")
+			}
+		}
+	}
+	// validateDeliveryOptions validates the options of the repository changes delivery,
+	// used both for the synchronized repositories and the root repository (see 'gitsync upstream').
+	validateDeliveryOptions := func(repo *Repository, path string) {
+		validatePushStrategy(repo, repo.PushStrategy, path+".pushStrategy")
+		validateDelivery(repo, repo.Delivery, path+".delivery")
+		validatePullRequest(repo, repo.PullRequest, path+".pullRequest")
+		validateCommit(repo, repo.Commit, path+".commit")
+		validateHooks(repo, repo.Hooks, path)
+		if repo.Fork != nil {
+			if u, err := giturl.Parse(repo.URL); err == nil && u.IsLocal() {
+				v.add(repo, path+".fork", "local repository cannot be forked")
+			}
+		}
+	}
+	validateClone(nil, c.Clone, "$.clone")
+	validateCommit(nil, c.Commit, "$.commit")
+	validatePullRequest(nil, c.PullRequest, "$.pullRequest")
+	validateTemplates(nil, c.Templates, "$.templates")
+	validatePushStrategy(nil, c.PushStrategy, "$.pushStrategy")
+	validateDelivery(nil, c.Delivery, "$.delivery")
+	if c.Root != nil {
+		validateRepo(c.Root, "$.root")
+		validateClone(c.Root, c.Root.Clone, "$.root.clone")
+		validateDeliveryOptions(c.Root, "$.root")
+	}
+	repoIndex := v.indexer("syncRepositories")
+	for _, repo := range c.Repositories {
+		path := repoIndex(repo)
+		validateRepo(repo, path)
+		validateClone(repo, repo.Clone, path+".clone")
+		validateTemplates(repo, repo.Templates, path+".templates")
+		validateDeliveryOptions(repo, path)
+	}
+	discoveryIndex := v.indexer("discover")
+	for _, discovery := range c.Discover {
+		path := discoveryIndex(discovery)
+		if discovery.Owner == "" {
+			v.add(discovery, path+".owner", "repositories owner is required")
+		}
+		if discovery.NameRegex != "" {
+			if _, err := regexp.Compile(discovery.NameRegex); err != nil {
+				v.add(discovery, path+".nameRegex", "invalid regular expression: %v", err)
+			}
+		}
+		switch discovery.Protocol {
+		case "", "https", "ssh":
+		default:
+			v.add(discovery, path+".protocol", "protocol must be either 'https' or 'ssh', got '%s'", discovery.Protocol)
+		}
+	}
+	fileNames := make(map[string]*File)
+	fileIndex := v.indexer("syncFiles")
+	for _, file := range c.SyncFiles {
+		path := fileIndex(file)
+		if file.Name == "" {
+			v.add(file, path+".name", "file name is required")
+		} else if defined, ok := fileNames[file.Name]; ok {
+			v.add(file, path+".name", "file name '%s' is not unique%s",
+				file.Name, c.describeDuplicate(defined, file))
+		} else {
+			fileNames[file.Name] = file
+		}
+		if file.Path == "" {
+			v.add(file, path+".path", "file path is required")
+		}
+		validateHooks(file, file.Hooks, path)
+		v.validateSelector(file, path, file.Selector)
+	}
+	ignoreIndex := v.indexer("ignore")
+	for _, ignore := range c.Ignore {
+		path := ignoreIndex(ignore)
+		if ignore.Regex == nil && ignore.Hunks == nil {
+			v.add(ignore, path, "either 'regex' or 'hunks' needs to be defined")
+		}
+		if ignore.RepositoryName != nil && !c.hasRepository(*ignore.RepositoryName) {
+			v.add(ignore, path+".repositoryName",
+				"repository '%s' is not defined in 'syncRepositories'", *ignore.RepositoryName)
+		}
+		if ignore.FileName != nil && fileNames[*ignore.FileName] == nil {
+			v.add(ignore, path+".fileName", "file '%s' is not defined in 'syncFiles'", *ignore.FileName)
+		}
+		for i, regex := range ignore.Regex {
+			if err := validateBasicRegex(regex); err != nil {
+				v.add(ignore, fmt.Sprintf("%s.regex[%d]", path, i), "invalid regular expression: %v", err)
+			}
+		}
+		for i, hunk := range ignore.Hunks {
+			if len(hunk.Changes) == 0 {
+				v.add(ignore, fmt.Sprintf("%s.hunks[%d].changes", path, i), "at least one change is required")
+			}
+		}
+		v.validateSelector(ignore, path, ignore.Selector)
+	}
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+	return nil
+}
+
+// hasRepository reports whether the synchronized repository is defined.
+// Names of the discovered repositories are not known until they're resolved,
+// any name is accepted if there are [Config.Discover] queries defined.
+func (c *Config) hasRepository(name string) bool {
+	return len(c.Discover) > 0 ||
+		slices.ContainsFunc(c.Repositories, func(r *Repository) bool { return r.Name == name })
+}
+
+type validator struct {
+	config *Config
+	errs   ValidationErrors
+}
+
+func (v *validator) add(entity any, path, format string, a ...any) {
+	v.errs = append(v.errs, ValidationError{
+		Source:  v.config.origins[entity],
+		Path:    path,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+// indexer returns a function which, for consecutive entities of the list, returns their JSON paths.
+// If the config includes other configs, the index is relative to the config file which defined the entity.
+func (v *validator) indexer(list string) func(entity any) string {
+	counts := make(map[string]int)
+	return func(entity any) string {
+		origin := v.config.origins[entity]
+		path := fmt.Sprintf("$.%s[%d]", list, counts[origin])
+		counts[origin]++
+		return path
+	}
+}
+
+func (v *validator) validateSelector(entity any, path string, selector Selector) {
+	for i, name := range selector.Repositories {
+		if !v.config.hasRepository(name) {
+			v.add(entity, fmt.Sprintf("%s.repositories[%d]", path, i),
+				"selected repository '%s' is not defined in 'syncRepositories'", name)
+		}
+	}
+}
@@ -36,12 +36,12 @@ func (u UnifiedFormat) String(original bool) string {
 // Hunk represents a single diff hunk in of [UnifiedFormat].
 type Hunk struct {
 	// Lines is the '@@' header containing the line numbers.
-	Lines string `json:"lines,omitempty"`
+	Lines string `json:"lines,omitempty" yaml:"lines,omitempty"`
 	// Changes contains only the changed lines, without any context.
-	Changes []string `json:"changes"`
+	Changes []string `json:"changes" yaml:"changes"`
 	// Original is the original string representation of the hunk.
 	// It may include color codes.
-	Original string `json:"-"`
+	Original string `json:"-" yaml:"-"`
 }
 
 func (h Hunk) String() string {
@@ -69,6 +69,35 @@ func (h Hunk) Equal(other Hunk) bool {
 	return true
 }
 
+// Reverse returns the [Hunk] which reverts the changes, i.e. swaps the removed and added lines.
+// It expects the hunk to have no context lines, as produced by 'diff -U 0'.
+// [Hunk.Original] is not preserved.
+func (h Hunk) Reverse() Hunk {
+	var removed, added []string
+	var last *[]string
+	for _, line := range h.Changes {
+		switch {
+		case strings.HasPrefix(line, "-"):
+			removed = append(removed, "+"+line[1:])
+			last = &removed
+		case strings.HasPrefix(line, "+"):
+			added = append(added, "-"+line[1:])
+			last = &added
+		case last != nil:
+			// Markers, like '\ No newline at end of file', refer to the preceding line.
+			*last = append(*last, line)
+		}
+	}
+	reversed := Hunk{Changes: append(added, removed...)}
+	if h.Lines != "" {
+		reversed.Lines = hunkLinesRegex.ReplaceAllString(h.Lines, "@@ -${new} +${old} @@")
+	}
+	return reversed
+}
+
+// hunkLinesRegex matches the line ranges of the [Hunk.Lines] header.
+var hunkLinesRegex = regexp.MustCompile(`^@@ -(?P<old>\S+) \+(?P<new>\S+) @@`)
+
 var colorCodeRegex = regexp.MustCompile(`\x1b\[\d+m(?P<content>.*)\x1b\[\d+m`)
 
 func ParseDiffOutput(output io.Reader) (*UnifiedFormat, error) {
@@ -0,0 +1,52 @@
+package diff
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestHunk_Reverse(t *testing.T) {
+	tests := map[string]struct {
+		hunk     Hunk
+		expected Hunk
+	}{
+		"changed lines": {
+			hunk: Hunk{
+				Lines:   "@@ -3,2 +3 @@",
+				Changes: []string{"-    - govet", "-    - lll", "+    - errcheck"},
+			},
+			expected: Hunk{
+				Lines:   "@@ -3 +3,2 @@",
+				Changes: []string{"-    - errcheck", "+    - govet", "+    - lll"},
+			},
+		},
+		"no newline at end of file": {
+			hunk: Hunk{
+				Lines:   "@@ -5 +5 @@",
+				Changes: []string{"-version: 1", `\ No newline at end of file`, "+version: 2"},
+			},
+			expected: Hunk{
+				Lines:   "@@ -5 +5 @@",
+				Changes: []string{"-version: 2", "+version: 1", `\ No newline at end of file`},
+			},
+		},
+		"no lines": {
+			hunk:     Hunk{Changes: []string{"+  skip-dirs:"}},
+			expected: Hunk{Changes: []string{"-  skip-dirs:"}},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			reversed := test.hunk.Reverse()
+			if reversed.Lines != test.expected.Lines {
+				t.Errorf("expected lines %q, got %q", test.expected.Lines, reversed.Lines)
+			}
+			if !slices.Equal(reversed.Changes, test.expected.Changes) {
+				t.Errorf("expected changes %q, got %q", test.expected.Changes, reversed.Changes)
+			}
+			if !reversed.Reverse().Equal(test.hunk) {
+				t.Errorf("expected double reversed hunk to equal the original hunk, got %+v", reversed.Reverse())
+			}
+		})
+	}
+}
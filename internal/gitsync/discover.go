@@ -0,0 +1,62 @@
+package gitsync
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/nieomylnieja/gitsync/internal/config"
+)
+
+// DiscoverRepositories resolves [config.Config.Discover] queries through the forge API
+// and merges the discovered repositories with the explicitly defined ones.
+func DiscoverRepositories(conf *config.Config) error {
+	if len(conf.Discover) == 0 {
+		return nil
+	}
+	f := newGitHubForge()
+	for _, discovery := range conf.Discover {
+		repos, err := discoverRepositories(f, discovery)
+		if err != nil {
+			return fmt.Errorf("failed to discover %s repositories: %w", discovery.Owner, err)
+		}
+		added := conf.AddDiscoveredRepositories(repos)
+		fmt.Printf("%s: discovered %d repositories\n", discovery.Owner, len(added))
+	}
+	return nil
+}
+
+func discoverRepositories(f forge, discovery *config.Discovery) ([]*config.Repository, error) {
+	forgeRepos, err := f.ListRepositories(discovery.Owner)
+	if err != nil {
+		return nil, err
+	}
+	var nameRegex *regexp.Regexp
+	if discovery.NameRegex != "" {
+		nameRegex = regexp.MustCompile(discovery.NameRegex)
+	}
+	repos := make([]*config.Repository, 0, len(forgeRepos))
+	for _, forgeRepo := range forgeRepos {
+		switch {
+		case forgeRepo.IsArchived && !discovery.IncludeArchived,
+			forgeRepo.IsFork && !discovery.IncludeForks,
+			discovery.Topic != "" && !slices.Contains(forgeRepo.Topics, discovery.Topic),
+			nameRegex != nil && !nameRegex.MatchString(forgeRepo.Name):
+			continue
+		}
+		repo := &config.Repository{
+			Name: forgeRepo.Name,
+			URL:  forgeRepo.URL,
+			Ref:  discovery.Ref,
+			Tags: slices.Clone(discovery.Tags),
+		}
+		if discovery.Protocol == "ssh" {
+			repo.URL = forgeRepo.SSHURL
+		}
+		if repo.Ref == "" && forgeRepo.DefaultBranch != "" {
+			repo.Ref = "origin/" + forgeRepo.DefaultBranch
+		}
+		repos = append(repos, repo)
+	}
+	return repos, nil
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
 	"slices"
 )
@@ -13,6 +14,8 @@ type command struct {
 	skipErroneousStatus []int
 	stdin               io.Reader
 	env                 []string
+	dir                 string
+	combineOutput       bool
 }
 
 func newCmd() *command {
@@ -33,11 +36,25 @@ func (c *command) SetStdin(stdin io.Reader) *command {
 	return c
 }
 
+// WithEnv sets the environment variable on top of the inherited environment.
 func (c *command) WithEnv(key, value string) *command {
 	c.env = append(c.env, fmt.Sprintf("%s=%s", key, value))
 	return c
 }
 
+// SetDir sets the working directory of the command.
+func (c *command) SetDir(dir string) *command {
+	c.dir = dir
+	return c
+}
+
+// CombineOutput captures stderr together with stdout, the combined output is both returned
+// and included in the error.
+func (c *command) CombineOutput() *command {
+	c.combineOutput = true
+	return c
+}
+
 func (c *command) Exec(name string, arg ...string) (*bytes.Buffer, error) {
 	cmd := exec.Command(name, arg...)
 	if cmd.Stdout != nil {
@@ -50,17 +67,25 @@ func (c *command) Exec(name string, arg ...string) (*bytes.Buffer, error) {
 		cmd.Stdin = c.stdin
 	}
 	if len(c.env) > 0 {
-		cmd.Env = c.env
+		cmd.Env = append(os.Environ(), c.env...)
 	}
+	cmd.Dir = c.dir
 	var stdout, stderr bytes.Buffer
 	cmd.Stderr = &stderr
 	cmd.Stdout = &stdout
+	if c.combineOutput {
+		cmd.Stderr = &stdout
+	}
 	if err := cmd.Run(); err != nil {
 		var execErr *exec.ExitError
 		if errors.As(err, &execErr) && slices.Contains(c.skipErroneousStatus, execErr.ExitCode()) {
 			return &stdout, nil
 		}
-		return nil, fmt.Errorf("failed to execute '%s' command: %s", cmd, stderr.String())
+		output := stderr.String()
+		if c.combineOutput {
+			output = stdout.String()
+		}
+		return nil, fmt.Errorf("failed to execute '%s' command: %s", cmd, output)
 	}
 	return &stdout, nil
 }
@@ -0,0 +1,580 @@
+package gitsync
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nieomylnieja/gitsync/internal/config"
+	"github.com/nieomylnieja/gitsync/internal/giturl"
+)
+
+// forge is the API of the service hosting the repositories, like GitHub.
+type forge interface {
+	// ListRepositories lists all the repositories owned by the organization, group or user.
+	ListRepositories(owner string) ([]forgeRepository, error)
+	// ListPullRequests lists the repository's pull requests from the head branch into the base branch
+	// in any state, newest first.
+	// The head branch is matched regardless of the repository it belongs to, which can be a fork.
+	ListPullRequests(repo *giturl.URL, head, base string) ([]pullRequest, error)
+	// GetPullRequest returns the repository's pull request with the number.
+	GetPullRequest(repo *giturl.URL, number int) (*pullRequest, error)
+	// CreatePullRequest opens a new pull request.
+	CreatePullRequest(repo *giturl.URL, pr newPullRequest) (*pullRequest, error)
+	// UpdatePullRequest replaces the pull request's title and body and adds labels, reviewers and assignees.
+	UpdatePullRequest(repo *giturl.URL, number int, update pullRequestUpdate) error
+	// ReopenPullRequest reopens the closed pull request.
+	ReopenPullRequest(repo *giturl.URL, number int) error
+	// ClosePullRequest closes the pull request with the comment.
+	ClosePullRequest(repo *giturl.URL, number int, comment string) error
+	// DeleteBranch deletes the repository's branch.
+	DeleteBranch(repo *giturl.URL, branch string) error
+	// ForkRepository returns the repository's fork with the owner and name, creating it if it does not exist.
+	// If a repository with the owner and name exists, but it's not the repository's fork, an error is returned.
+	ForkRepository(repo *giturl.URL, owner, name string) (*forgeRepository, error)
+	// SetPullRequestDraft converts the pull request to a draft or marks it as ready for review.
+	SetPullRequestDraft(repo *giturl.URL, number int, draft bool) error
+	// EnableAutoMerge enables auto-merge of the pull request with the merge method.
+	EnableAutoMerge(repo *giturl.URL, number int, method config.MergeMethod) error
+	// CurrentUser returns the login of the authenticated user.
+	CurrentUser() (string, error)
+}
+
+type forgeRepository struct {
+	Name          string
+	URL           string
+	SSHURL        string
+	DefaultBranch string
+	Topics        []string
+	IsArchived    bool
+	IsFork        bool
+	// Parent is the full name of the forked repository, e.g. 'nieomylnieja/gitsync', empty if it's not a fork.
+	Parent string
+}
+
+type pullRequestState string
+
+const (
+	pullRequestOpen   pullRequestState = "OPEN"
+	pullRequestClosed pullRequestState = "CLOSED"
+	pullRequestMerged pullRequestState = "MERGED"
+)
+
+type pullRequest struct {
+	Number     int
+	Title      string
+	Body       string
+	URL        string
+	State      pullRequestState
+	HeadBranch string
+	// HeadOwner is the owner of the repository the head branch belongs to.
+	HeadOwner  string
+	BaseBranch string
+	Labels     []string
+	Assignees  []string
+	// Reviewers are the users and teams ('organization/team') which were requested to review
+	// the pull request or have already reviewed it.
+	Reviewers []string
+	IsDraft   bool
+	AutoMerge bool
+}
+
+type newPullRequest struct {
+	Title string
+	Body  string
+	// Base is the branch the changes are merged into.
+	Base string
+	// Head is the branch which contains the changes.
+	Head string
+	// HeadOwner is the owner of the fork which contains the head branch,
+	// empty if the branch belongs to the repository itself.
+	HeadOwner string
+	// Reviewers are the users and teams ('organization/team') requested to review the pull request.
+	Reviewers []string
+	Labels    []string
+	Assignees []string
+	Draft     bool
+}
+
+type pullRequestUpdate struct {
+	Title        string
+	Body         string
+	AddLabels    []string
+	AddReviewers []string
+	AddAssignees []string
+}
+
+// githubForge implements [forge] with GitHub CLI.
+type githubForge struct {
+	token string
+	login string
+}
+
+func newGitHubForge() *githubForge {
+	return &githubForge{}
+}
+
+// gh executes GitHub CLI command authenticated with the user's token.
+func (g *githubForge) gh(args ...string) ([]byte, error) {
+	if g.token == "" {
+		out, err := execCmd("gh", "auth", "token")
+		if err != nil {
+			return nil, fmt.Errorf("failed to get GitHub token: %w", err)
+		}
+		g.token = strings.TrimSpace(out.String())
+	}
+	out, err := newCmd().
+		WithEnv("GH_TOKEN", g.token).
+		Exec("gh", args...)
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// ghRepositoryFields are the fields of [ghRepository] requested from GitHub CLI.
+const ghRepositoryFields = "name,url,sshUrl,isArchived,isFork,defaultBranchRef,repositoryTopics"
+
+type ghRepository struct {
+	Name             string `json:"name"`
+	URL              string `json:"url"`
+	SSHURL           string `json:"sshUrl"`
+	IsArchived       bool   `json:"isArchived"`
+	IsFork           bool   `json:"isFork"`
+	DefaultBranchRef struct {
+		Name string `json:"name"`
+	} `json:"defaultBranchRef"`
+	RepositoryTopics []struct {
+		Name string `json:"name"`
+	} `json:"repositoryTopics"`
+	Parent *struct {
+		Name  string `json:"name"`
+		Owner struct {
+			Login string `json:"login"`
+		} `json:"owner"`
+	} `json:"parent"`
+}
+
+func (g *githubForge) ListRepositories(owner string) ([]forgeRepository, error) {
+	out, err := g.gh(
+		"repo",
+		"list", owner,
+		"--limit", "10000",
+		"--json", ghRepositoryFields,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list GitHub repositories: %w", err)
+	}
+	var ghRepos []ghRepository
+	if err = json.Unmarshal(out, &ghRepos); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal GitHub repositories list response: %w", err)
+	}
+	repos := make([]forgeRepository, 0, len(ghRepos))
+	for _, ghRepo := range ghRepos {
+		repos = append(repos, ghRepo.toForgeRepository())
+	}
+	return repos, nil
+}
+
+func (r ghRepository) toForgeRepository() forgeRepository {
+	topics := make([]string, 0, len(r.RepositoryTopics))
+	for _, topic := range r.RepositoryTopics {
+		topics = append(topics, topic.Name)
+	}
+	repo := forgeRepository{
+		Name:          r.Name,
+		URL:           r.URL + ".git",
+		SSHURL:        r.SSHURL,
+		DefaultBranch: r.DefaultBranchRef.Name,
+		Topics:        topics,
+		IsArchived:    r.IsArchived,
+		IsFork:        r.IsFork,
+	}
+	if r.Parent != nil {
+		repo.Parent = r.Parent.Owner.Login + "/" + r.Parent.Name
+	}
+	return repo
+}
+
+// webURL returns the URL of the repository's web page, e.g. 'https://github.com/nieomylnieja/gitsync',
+// or an empty string for local repositories.
+func webURL(repoURL string) string {
+	u, err := giturl.Parse(repoURL)
+	if err != nil {
+		return ""
+	}
+	return u.WebURL()
+}
+
+// commitURL returns the URL of the commit's web page, or an empty string for local repositories.
+func commitURL(repoURL, sha string) string {
+	web := webURL(repoURL)
+	if web == "" {
+		return ""
+	}
+	return web + detectWebLayout(repoURL).commit + sha
+}
+
+// fileURL returns the permalink to the file at the commit, or an empty string for local repositories.
+func fileURL(repoURL, sha, filePath string) string {
+	web := webURL(repoURL)
+	if web == "" {
+		return ""
+	}
+	return web + detectWebLayout(repoURL).file + sha + "/" + strings.TrimPrefix(filePath, "/")
+}
+
+// webLayout describes the paths of the commit and file pages, relative to the repository's web page.
+type webLayout struct {
+	commit string
+	file   string
+}
+
+var (
+	githubWebLayout = webLayout{commit: "/commit/", file: "/blob/"}
+	gitlabWebLayout = webLayout{commit: "/-/commit/", file: "/-/blob/"}
+	giteaWebLayout  = webLayout{commit: "/commit/", file: "/src/commit/"}
+)
+
+// detectWebLayout guesses the forge hosting the repository from its host name.
+// Unrecognized hosts, e.g. GitHub Enterprise servers, are assumed to follow GitHub's layout.
+func detectWebLayout(repoURL string) webLayout {
+	u, err := giturl.Parse(repoURL)
+	if err != nil {
+		return githubWebLayout
+	}
+	host := strings.ToLower(u.Host)
+	switch {
+	case strings.Contains(host, "gitlab"):
+		return gitlabWebLayout
+	case host == "codeberg.org" || strings.Contains(host, "gitea") || strings.Contains(host, "forgejo"):
+		return giteaWebLayout
+	default:
+		return githubWebLayout
+	}
+}
+
+// ghPullRequestFields are the fields of [ghPullRequest] requested from GitHub CLI.
+const ghPullRequestFields = "number,title,body,url,state,headRefName,headRepositoryOwner,baseRefName," +
+	"labels,assignees,reviewRequests,latestReviews,isDraft,autoMergeRequest"
+
+type ghPullRequest struct {
+	Number      int              `json:"number"`
+	Title       string           `json:"title"`
+	Body        string           `json:"body"`
+	URL         string           `json:"url"`
+	State       pullRequestState `json:"state"`
+	HeadRefName string           `json:"headRefName"`
+	HeadOwner   struct {
+		Login string `json:"login"`
+	} `json:"headRepositoryOwner"`
+	BaseRefName string `json:"baseRefName"`
+	Labels      []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	Assignees []struct {
+		Login string `json:"login"`
+	} `json:"assignees"`
+	// ReviewRequests contain either users (login) or teams (slug).
+	ReviewRequests []struct {
+		Login string `json:"login"`
+		Slug  string `json:"slug"`
+	} `json:"reviewRequests"`
+	LatestReviews []struct {
+		Author struct {
+			Login string `json:"login"`
+		} `json:"author"`
+	} `json:"latestReviews"`
+	IsDraft          bool            `json:"isDraft"`
+	AutoMergeRequest json.RawMessage `json:"autoMergeRequest"`
+}
+
+func (p ghPullRequest) toPullRequest() pullRequest {
+	pr := pullRequest{
+		Number:     p.Number,
+		Title:      p.Title,
+		Body:       p.Body,
+		URL:        p.URL,
+		State:      p.State,
+		HeadBranch: p.HeadRefName,
+		HeadOwner:  p.HeadOwner.Login,
+		BaseBranch: p.BaseRefName,
+		IsDraft:    p.IsDraft,
+		AutoMerge:  len(p.AutoMergeRequest) > 0 && string(p.AutoMergeRequest) != "null",
+	}
+	for _, label := range p.Labels {
+		pr.Labels = append(pr.Labels, label.Name)
+	}
+	for _, assignee := range p.Assignees {
+		pr.Assignees = append(pr.Assignees, assignee.Login)
+	}
+	for _, request := range p.ReviewRequests {
+		pr.Reviewers = append(pr.Reviewers, cmp.Or(request.Login, request.Slug))
+	}
+	for _, review := range p.LatestReviews {
+		pr.Reviewers = append(pr.Reviewers, review.Author.Login)
+	}
+	return pr
+}
+
+func (g *githubForge) ListPullRequests(repo *giturl.URL, head, base string) ([]pullRequest, error) {
+	out, err := g.gh(
+		"pr",
+		"list",
+		"-R", repo.String(),
+		"--state", "all",
+		"--head", head,
+		"--base", base,
+		"--json", ghPullRequestFields,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list GitHub pull requests: %w", err)
+	}
+	var ghPRs []ghPullRequest
+	if err = json.Unmarshal(out, &ghPRs); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal GitHub pull requests list response: %w", err)
+	}
+	prs := make([]pullRequest, 0, len(ghPRs))
+	for _, ghPR := range ghPRs {
+		prs = append(prs, ghPR.toPullRequest())
+	}
+	return prs, nil
+}
+
+func (g *githubForge) GetPullRequest(repo *giturl.URL, number int) (*pullRequest, error) {
+	out, err := g.gh(
+		"pr",
+		"view", strconv.Itoa(number),
+		"-R", repo.String(),
+		"--json", ghPullRequestFields,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get GitHub pull request: %w", err)
+	}
+	var ghPR ghPullRequest
+	if err = json.Unmarshal(out, &ghPR); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal GitHub pull request response: %w", err)
+	}
+	pr := ghPR.toPullRequest()
+	return &pr, nil
+}
+
+func (g *githubForge) CreatePullRequest(repo *giturl.URL, pr newPullRequest) (*pullRequest, error) {
+	head := pr.Head
+	if pr.HeadOwner != "" {
+		// Cross-repository pull requests reference the head branch with '<owner>:<branch>' syntax.
+		head = pr.HeadOwner + ":" + pr.Head
+	}
+	args := []string{
+		"pr",
+		"create",
+		"-R", repo.String(),
+		"--title", pr.Title,
+		"--body", pr.Body,
+		"--base", pr.Base,
+		"--head", head,
+	}
+	args = appendRepeatedFlag(args, "--label", pr.Labels)
+	args = appendRepeatedFlag(args, "--reviewer", pr.Reviewers)
+	args = appendRepeatedFlag(args, "--assignee", pr.Assignees)
+	if pr.Draft {
+		args = append(args, "--draft")
+	}
+	out, err := g.gh(args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GitHub pull request: %w", err)
+	}
+	// GitHub CLI prints the URL of the created pull request, e.g. 'https://github.com/owner/repo/pull/1'.
+	prURL := strings.TrimSpace(string(out))
+	number, err := strconv.Atoi(path.Base(prURL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub pull request number from its URL %s: %w", prURL, err)
+	}
+	return &pullRequest{
+		Number:     number,
+		Title:      pr.Title,
+		Body:       pr.Body,
+		URL:        prURL,
+		State:      pullRequestOpen,
+		HeadBranch: pr.Head,
+		HeadOwner:  cmp.Or(pr.HeadOwner, repo.Owner),
+		BaseBranch: pr.Base,
+		Labels:     pr.Labels,
+		Assignees:  pr.Assignees,
+		Reviewers:  pr.Reviewers,
+		IsDraft:    pr.Draft,
+	}, nil
+}
+
+func (g *githubForge) UpdatePullRequest(repo *giturl.URL, number int, update pullRequestUpdate) error {
+	args := []string{
+		"pr",
+		"edit", strconv.Itoa(number),
+		"-R", repo.String(),
+		"--title", update.Title,
+		"--body", update.Body,
+	}
+	args = appendRepeatedFlag(args, "--add-label", update.AddLabels)
+	args = appendRepeatedFlag(args, "--add-reviewer", update.AddReviewers)
+	args = appendRepeatedFlag(args, "--add-assignee", update.AddAssignees)
+	if _, err := g.gh(args...); err != nil {
+		return fmt.Errorf("failed to update GitHub pull request: %w", err)
+	}
+	return nil
+}
+
+func (g *githubForge) ReopenPullRequest(repo *giturl.URL, number int) error {
+	if _, err := g.gh("pr", "reopen", strconv.Itoa(number), "-R", repo.String()); err != nil {
+		return fmt.Errorf("failed to reopen GitHub pull request: %w", err)
+	}
+	return nil
+}
+
+func (g *githubForge) ClosePullRequest(repo *giturl.URL, number int, comment string) error {
+	if _, err := g.gh(
+		"pr",
+		"close", strconv.Itoa(number),
+		"-R", repo.String(),
+		"--comment", comment,
+	); err != nil {
+		return fmt.Errorf("failed to close GitHub pull request: %w", err)
+	}
+	return nil
+}
+
+func (g *githubForge) DeleteBranch(repo *giturl.URL, branch string) error {
+	if _, err := g.gh(
+		"api",
+		"--hostname", repo.Host,
+		"--method", "DELETE",
+		fmt.Sprintf("repos/%s/git/refs/heads/%s", repo.FullName(), branch),
+	); err != nil {
+		return fmt.Errorf("failed to delete GitHub repository %s branch: %w", branch, err)
+	}
+	return nil
+}
+
+func (g *githubForge) ForkRepository(repo *giturl.URL, owner, name string) (*forgeRepository, error) {
+	fork := &giturl.URL{Host: repo.Host, Owner: owner, Name: name}
+	existing, err := g.getRepository(fork)
+	switch {
+	case err == nil:
+		if err = verifyFork(existing, fork, repo); err != nil {
+			return nil, err
+		}
+		return existing, nil
+	case !errors.Is(err, errRepositoryNotFound):
+		return nil, err
+	}
+	login, err := g.CurrentUser()
+	if err != nil {
+		return nil, err
+	}
+	args := []string{
+		"repo",
+		"fork", repo.String(),
+		"--clone=false",
+		"--remote=false",
+		"--fork-name", name,
+	}
+	if !strings.EqualFold(owner, login) {
+		args = append(args, "--org", owner)
+	}
+	if _, err = g.gh(args...); err != nil {
+		return nil, fmt.Errorf("failed to fork GitHub repository: %w", err)
+	}
+	for attempt := 1; ; attempt++ {
+		created, err := g.getRepository(fork)
+		if !errors.Is(err, errRepositoryNotFound) || attempt >= forkReadyAttempts {
+			return created, err
+		}
+		time.Sleep(forkReadyInterval)
+	}
+}
+
+// verifyFork checks that the existing repository is the fork of the repository.
+func verifyFork(existing *forgeRepository, fork, repo *giturl.URL) error {
+	if !existing.IsFork {
+		return fmt.Errorf("repository %s already exists and is not a fork of %s", fork.FullName(), repo.FullName())
+	}
+	if !strings.EqualFold(existing.Parent, repo.FullName()) {
+		return fmt.Errorf("repository %s is a fork of %s, not %s", fork.FullName(), existing.Parent, repo.FullName())
+	}
+	return nil
+}
+
+// errRepositoryNotFound is returned by [githubForge.getRepository] if the repository does not exist.
+var errRepositoryNotFound = errors.New("repository not found")
+
+// ghRepositoryViewFields are the fields of [ghRepository] requested from GitHub CLI for a single repository.
+const ghRepositoryViewFields = ghRepositoryFields + ",parent"
+
+func (g *githubForge) getRepository(repo *giturl.URL) (*forgeRepository, error) {
+	out, err := g.gh(
+		"repo",
+		"view", repo.String(),
+		"--json", ghRepositoryViewFields,
+	)
+	if err != nil {
+		// GitHub CLI does not report not found repositories with a distinct exit code.
+		if strings.Contains(err.Error(), "Could not resolve to a Repository") {
+			return nil, fmt.Errorf("%w: %s", errRepositoryNotFound, repo.FullName())
+		}
+		return nil, fmt.Errorf("failed to get GitHub repository: %w", err)
+	}
+	var ghRepo ghRepository
+	if err = json.Unmarshal(out, &ghRepo); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal GitHub repository response: %w", err)
+	}
+	forgeRepo := ghRepo.toForgeRepository()
+	return &forgeRepo, nil
+}
+
+func (g *githubForge) SetPullRequestDraft(repo *giturl.URL, number int, draft bool) error {
+	args := []string{"pr", "ready", strconv.Itoa(number), "-R", repo.String()}
+	if draft {
+		args = append(args, "--undo")
+	}
+	if _, err := g.gh(args...); err != nil {
+		return fmt.Errorf("failed to change GitHub pull request draft status: %w", err)
+	}
+	return nil
+}
+
+func (g *githubForge) EnableAutoMerge(repo *giturl.URL, number int, method config.MergeMethod) error {
+	if _, err := g.gh(
+		"pr",
+		"merge", strconv.Itoa(number),
+		"-R", repo.String(),
+		"--auto",
+		"--"+string(method),
+	); err != nil {
+		return fmt.Errorf("failed to enable GitHub pull request auto-merge: %w", err)
+	}
+	return nil
+}
+
+func (g *githubForge) CurrentUser() (string, error) {
+	if g.login != "" {
+		return g.login, nil
+	}
+	out, err := g.gh("api", "user", "--jq", ".login")
+	if err != nil {
+		return "", fmt.Errorf("failed to get GitHub user: %w", err)
+	}
+	g.login = strings.TrimSpace(string(out))
+	return g.login, nil
+}
+
+// appendRepeatedFlag appends the flag with each of the values to the arguments.
+func appendRepeatedFlag(args []string, flag string, values []string) []string {
+	for _, value := range values {
+		args = append(args, flag, value)
+	}
+	return args
+}
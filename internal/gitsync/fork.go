@@ -0,0 +1,110 @@
+package gitsync
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nieomylnieja/gitsync/internal/config"
+	"github.com/nieomylnieja/gitsync/internal/giturl"
+)
+
+// forkRemote is the name of the git remote pointing to the repository's fork.
+const forkRemote = "fork"
+
+// Forks are created asynchronously, the newly created fork might not be available right away.
+// Waiting for it is bounded by the number of attempts made with the interval.
+var (
+	forkReadyAttempts = 10
+	forkReadyInterval = 3 * time.Second
+)
+
+// headRepository returns the repository the sync branch is pushed to,
+// either the repository's fork (see [config.ForkOptions]) or the repository itself.
+func headRepository(f forge, repo *config.Repository, u *giturl.URL) (*giturl.URL, error) {
+	if repo.Fork == nil {
+		return u, nil
+	}
+	owner := repo.Fork.Owner
+	if owner == "" {
+		login, err := f.CurrentUser()
+		if err != nil {
+			return nil, err
+		}
+		owner = login
+	}
+	return &giturl.URL{
+		Scheme: u.Scheme,
+		User:   u.User,
+		Host:   u.Host,
+		Port:   u.Port,
+		Owner:  owner,
+		Name:   cmp.Or(repo.Fork.Name, u.Name),
+	}, nil
+}
+
+// setupFork creates the repository's fork through the forge API if it does not exist yet
+// and points the store checkout's [forkRemote] at it, using the same protocol as the repository's URL.
+// It returns once the fork can be pushed to.
+func setupFork(f forge, repo *config.Repository) error {
+	u, err := giturl.Parse(repo.URL)
+	if err != nil {
+		return err
+	}
+	head, err := headRepository(f, repo, u)
+	if err != nil {
+		return err
+	}
+	fork, err := f.ForkRepository(u, head.Owner, head.Name)
+	if err != nil {
+		return err
+	}
+	forkURL := fork.URL
+	if u.Scheme == giturl.SchemeSSH {
+		forkURL = fork.SSHURL
+	}
+	path := repo.GetPath()
+	out, err := newCmd().
+		SkipErroneousStatus(2).
+		Exec("git", "-C", path, "remote", "get-url", forkRemote)
+	if err != nil {
+		return fmt.Errorf("failed to get repository fork remote URL: %w", err)
+	}
+	switch remoteURL := strings.TrimSpace(out.String()); remoteURL {
+	case forkURL:
+	case "":
+		fmt.Printf("%s: adding %s remote %s\n", repo.Name, forkRemote, forkURL)
+		_, err = execCmd("git", "-C", path, "remote", "add", forkRemote, forkURL)
+	default:
+		fmt.Printf("%s: updating %s remote URL from %s to %s\n", repo.Name, forkRemote, remoteURL, forkURL)
+		_, err = execCmd("git", "-C", path, "remote", "set-url", forkRemote, forkURL)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update repository fork remote URL: %w", err)
+	}
+	return waitForFork(repo)
+}
+
+// waitForFork waits until the [forkRemote] repository can be accessed with git.
+func waitForFork(repo *config.Repository) error {
+	var err error
+	for attempt := 1; attempt <= forkReadyAttempts; attempt++ {
+		if _, err = execCmd("git", "-C", repo.GetPath(), "ls-remote", "--heads", forkRemote); err == nil {
+			return nil
+		}
+		if attempt < forkReadyAttempts {
+			fmt.Printf("%s: waiting for the fork to become available\n", repo.Name)
+			time.Sleep(forkReadyInterval)
+		}
+	}
+	return fmt.Errorf("fork is not available after %d attempts: %w", forkReadyAttempts, err)
+}
+
+// forkOwner returns the owner of the head repository if it is the repository's fork, or an empty string.
+func forkOwner(repo *config.Repository, head *giturl.URL) string {
+	if repo.Fork == nil {
+		return ""
+	}
+	return head.Owner
+}
@@ -4,17 +4,20 @@ import (
 	"bufio"
 	"bytes"
 	"cmp"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"net/url"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
 	"slices"
+	"strconv"
 	"strings"
+	"text/template"
 
 	"github.com/nieomylnieja/gitsync/internal/config"
 	"github.com/nieomylnieja/gitsync/internal/diff"
+	"github.com/nieomylnieja/gitsync/internal/giturl"
 )
 
 type Command int
@@ -22,46 +25,101 @@ type Command int
 const (
 	CommandSync Command = iota
 	CommandDiff
+	// CommandUpstream applies the accepted hunks in the reverse direction,
+	// from the synchronized repository file to the root repository file.
+	CommandUpstream
 )
 
 const (
-	gitsyncUpdateBranch = "gitsync-update"
-	commitBaseMessage   = "chore: gitsync update"
-	promptMessage       = "Accept hunk? [Y|y|n|i|h]: "
-	gitsyncURL          = "https://github.com/nieomylnieja/gitsync"
+	promptMessage = "Accept hunk? [Y|y|n|i|h]: "
+	gitsyncURL    = "https://github.com/nieomylnieja/gitsync"
 )
 
-func Run(conf *config.Config, command Command) error {
-	if err := checkDependencies(); err != nil {
+// Options alter the behavior of [Run].
+type Options struct {
+	// Tags, if provided, limit the synchronized repositories to those
+	// which have at least one of the tags.
+	Tags []string
+	// DryRun, if true, applies the accepted changes in the local checkouts and prints the commit message
+	// and pull request which would be created, without committing, pushing and opening pull requests.
+	// The checkouts are reset afterward and the hunks ignored with the prompt should not be saved.
+	DryRun bool
+}
+
+func Run(conf *config.Config, command Command, opts Options) error {
+	if err := checkDependencies(conf, conf.Repositories, command == CommandDiff || opts.DryRun); err != nil {
+		return err
+	}
+	if err := DiscoverRepositories(conf); err != nil {
 		return err
 	}
 	// #nosec G304
 	if err := os.MkdirAll(conf.GetStorePath(), 0o750); err != nil {
 		return fmt.Errorf("failed to create repositories store under specified path: %w", err)
 	}
-	for _, repo := range append(conf.Repositories, conf.Root) {
+	syncedRepos := selectRepositories(conf, opts.Tags)
+	if len(syncedRepos) == 0 {
+		fmt.Println("No repositories match the provided tags.")
+		return nil
+	}
+	for _, repo := range append(syncedRepos, conf.Root) {
 		if err := cloneRepo(repo); err != nil {
 			return fmt.Errorf("failed to clone repository %s: %w", repo.Name, err)
 		}
-		if err := updateTrackedRef(repo); err != nil {
+		if err := updateTrackedRef(repo, sparseCheckoutPaths(conf, repo, syncedRepos)); err != nil {
 			return fmt.Errorf("failed to update repository %s: %w", repo.Name, err)
 		}
-		if command == CommandSync {
-			if err := checkoutSyncBranch(repo); err != nil {
-				return err
+	}
+	if opts.DryRun {
+		defer func() {
+			for _, repo := range syncedRepos {
+				if err := resetCheckout(repo); err != nil {
+					fmt.Printf("%s: %v\n", repo.Name, err)
+				}
 			}
-		}
+		}()
+	}
+	rootSHA, err := headCommit(conf.Root)
+	if err != nil {
+		return err
 	}
-	updatedFiles := make(map[*config.Repository][]string, len(conf.Repositories))
-	for _, syncedRepo := range conf.Repositories {
+	updatedFiles := make(map[*config.Repository][]syncedFile, len(syncedRepos))
+	differingRepos := make(map[*config.Repository]bool, len(syncedRepos))
+	for _, syncedRepo := range syncedRepos {
 		for _, file := range conf.SyncFiles {
+			if !file.Matches(syncedRepo) {
+				continue
+			}
 			rootFilePath := filepath.Join(conf.GetStorePath(), conf.Root.Name, file.Path)
-			updated, err := syncRepoFile(conf, command, syncedRepo, file, rootFilePath)
+			differing, hunks, err := syncRepoFile(conf, command, syncedRepo, file, rootFilePath)
 			if err != nil {
 				return fmt.Errorf("failed to sync %s repository file: %s: %w", syncedRepo.Name, file.Name, err)
 			}
-			if updated {
-				updatedFiles[syncedRepo] = append(updatedFiles[syncedRepo], file.Path)
+			if differing > 0 {
+				differingRepos[syncedRepo] = true
+			}
+			if hunks > 0 {
+				updatedFiles[syncedRepo] = append(updatedFiles[syncedRepo], syncedFile{
+					Name:  file.Name,
+					Path:  file.Path,
+					Hunks: hunks,
+				})
+			}
+		}
+	}
+	state, err := readSyncState(conf)
+	if err != nil {
+		return err
+	}
+	f := newGitHubForge()
+	// Diff and dry run are read-only, they do not interact with the forge.
+	if command == CommandSync && !opts.DryRun {
+		for _, repo := range syncedRepos {
+			if differingRepos[repo] {
+				continue
+			}
+			if err = closeObsoletePullRequest(f, conf.Root, repo, rootSHA, state); err != nil {
+				return fmt.Errorf("failed to close obsolete pull request of %s repository: %w", repo.Name, err)
 			}
 		}
 	}
@@ -72,79 +130,176 @@ func Run(conf *config.Config, command Command) error {
 		fmt.Println("No changes to synchronize.")
 		return nil
 	}
-	for repo, files := range updatedFiles {
-		commit, err := commitChanges(conf.Root, repo, files)
+	var hookErrs []error
+	for _, repo := range syncedRepos {
+		files, ok := updatedFiles[repo]
+		if !ok {
+			continue
+		}
+		if err = runHooks(conf, repo, files); err != nil {
+			fmt.Printf("%s: skipping commit, %v\n", repo.Name, err)
+			hookErrs = append(hookErrs, fmt.Errorf("failed to run %s repository hooks: %w", repo.Name, err))
+			// Leftovers of the failed hook must not be committed by the next sync.
+			if err = resetCheckout(repo); err != nil {
+				return err
+			}
+			continue
+		}
+		changed, err := hasChanges(repo)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			fmt.Printf("%s: no changes left after running hooks\n", repo.Name)
+			continue
+		}
+		previousRootSHA := state.Repositories[repo.Name].RootSHA
+		rootCommits, err := rootCommitsSince(conf.Root, previousRootSHA, rootSHA, files)
 		if err != nil {
+			return err
+		}
+		details, err := renderChangeDetails(
+			newChangeSummary(conf.Root, repo, rootSHA, previousRootSHA, rootCommits, files))
+		if err != nil {
+			return err
+		}
+		if opts.DryRun {
+			if err = printChangeDetails(repo, details); err != nil {
+				return err
+			}
+			continue
+		}
+		if err = commitChanges(repo, details); err != nil {
 			return fmt.Errorf("failed to commit changes to %s repository: %w", repo.Name, err)
 		}
-		if err = pushChanges(repo); err != nil {
+		if repo.GetDelivery() == config.DeliveryLocal {
+			fmt.Printf("%s: changes committed to %s branch in %s\n", repo.Name, details.Branch, repo.GetPath())
+			if err = state.recordSync(repo, rootSHA); err != nil {
+				return err
+			}
+			continue
+		}
+		remote := "origin"
+		if repo.Fork != nil {
+			if err = setupFork(f, repo); err != nil {
+				return fmt.Errorf("failed to set up fork of %s repository: %w", repo.Name, err)
+			}
+			remote = forkRemote
+		}
+		var pushed bool
+		if repo.GetDelivery() == config.DeliveryPush && repo.PushBranch != "" {
+			pushed, err = pushToBranch(repo, remote, repo.PushBranch)
+		} else {
+			pushed, err = pushChanges(repo, remote, details)
+		}
+		if err != nil {
 			return fmt.Errorf("failed to push changes to %s repository: %w", repo.Name, err)
 		}
-		if err = openPullRequest(repo, commit); err != nil {
+		if pushed {
+			if err = state.recordSync(repo, rootSHA); err != nil {
+				return err
+			}
+		}
+		if repo.GetDelivery() == config.DeliveryPush {
+			continue
+		}
+		repoState := state.Repositories[repo.Name]
+		if repoState.PullRequest, err = openPullRequest(f, repo, details, repoState.PullRequest); err != nil {
 			return fmt.Errorf("failed to open pull request for %s repository: %w", repo.Name, err)
 		}
+		state.Repositories[repo.Name] = repoState
+		if err = state.save(); err != nil {
+			return err
+		}
 	}
-	return nil
+	return errors.Join(hookErrs...)
 }
 
+// syncRepoFile compares the root and synchronized repository file and, depending on the command,
+// either prints the differences or applies the accepted hunks.
+// For [CommandUpstream] the hunks are applied to the root file instead, the ignore rules
+// are matched against the reversed hunks, so that they are shared with [CommandSync].
+// It returns the number of the differing hunks which are not ignored and the number of the applied ones.
 func syncRepoFile(
 	conf *config.Config,
 	command Command,
 	syncedRepo *config.Repository,
 	file *config.File,
 	rootFilePath string,
-) (bool, error) {
+) (differing, applied int, err error) {
 	syncedRepoFilePath := filepath.Join(conf.GetStorePath(), syncedRepo.Name, file.Path)
+	if file.Template {
+		renderedFilePath, err := renderRootFile(rootFilePath, syncedRepo)
+		if err != nil {
+			return 0, 0, err
+		}
+		defer func() { _ = os.Remove(renderedFilePath) }()
+		rootFilePath = renderedFilePath
+	}
 	regexes := make([]string, 0)
 	for _, ignore := range getIgnoreRules(conf, ignoreRulesQuery{
-		RepoName: syncedRepo.Name,
+		Repo:     syncedRepo,
 		FileName: file.Name,
 		Regex:    true,
 	}) {
 		regexes = append(regexes, ignore.Regex...)
 	}
+	upstream := command == CommandUpstream
+	targetFilePath, sourceFilePath := syncedRepoFilePath, rootFilePath
+	targetLabel := fmt.Sprintf("%s (synced): %s (%s)", syncedRepo.Name, file.Path, file.Name)
+	sourceLabel := fmt.Sprintf("%s (root): %s (%s)", conf.Root.Name, file.Path, file.Name)
+	if upstream {
+		targetFilePath, sourceFilePath = sourceFilePath, targetFilePath
+		targetLabel, sourceLabel = sourceLabel, targetLabel
+	}
 	args := []string{
 		"-U", "0",
 		"--ignore-all-space",
 		"--color=always",
-		"--label", fmt.Sprintf("%s (synced): %s (%s)", syncedRepo.Name, file.Path, file.Name),
-		"--label", fmt.Sprintf("%s (root): %s (%s)", conf.Root.Name, file.Path, file.Name),
+		"--label", targetLabel,
+		"--label", sourceLabel,
 	}
 	for _, regex := range regexes {
 		args = append(args, "-I")
 		args = append(args, regex)
 	}
 	args = append(args,
-		syncedRepoFilePath,
-		rootFilePath)
+		targetFilePath,
+		sourceFilePath)
 	out, err := newCmd().
 		SkipErroneousStatus(1).
 		Exec("diff", args...)
 	if err != nil {
-		return false, fmt.Errorf("failed to execute diff command: %w", err)
+		return 0, 0, fmt.Errorf("failed to execute diff command: %w", err)
 	}
 	if out.Len() == 0 {
-		return false, nil
+		return 0, 0, nil
 	}
 	unifiedFmt, err := diff.ParseDiffOutput(out)
 	if err != nil {
-		return false, err
+		return 0, 0, err
 	}
 	resultHunks := make([]diff.Hunk, 0, len(unifiedFmt.Hunks))
-	prompt := command == CommandSync
+	prompt := command == CommandSync || upstream
 hunkLoop:
 	for _, hunk := range unifiedFmt.Hunks {
+		// Ignore rules are defined for the root to synchronized repository direction.
+		ruleHunk := hunk
+		if upstream {
+			ruleHunk = hunk.Reverse()
+		}
 		for _, ignore := range getIgnoreRules(conf, ignoreRulesQuery{
-			RepoName: syncedRepo.Name,
+			Repo:     syncedRepo,
 			FileName: file.Name,
 			Hunk:     true,
 		}) {
 			for _, ignoreHunk := range ignore.Hunks {
-				if ignoreHunk.Equal(hunk) {
+				if ignoreHunk.Equal(ruleHunk) {
 					continue hunkLoop
 				}
 			}
 		}
+		differing++
 		if !prompt {
 			resultHunks = append(resultHunks, hunk)
 			continue
@@ -163,24 +318,8 @@ hunkLoop:
 				resultHunks = append(resultHunks, hunk)
 			case "n", "no":
 			case "i":
-				// Copy loop variable.
-				hunk := hunk
-				found := false
-				for _, ignore := range conf.Ignore {
-					if ignore.RepositoryName != nil && *ignore.RepositoryName == syncedRepo.Name &&
-						ignore.FileName != nil && *ignore.FileName == file.Name {
-						ignore.Hunks = append(ignore.Hunks, hunk)
-						found = true
-						break
-					}
-				}
-				if !found {
-					conf.Ignore = append(conf.Ignore, &config.IgnoreRule{
-						RepositoryName: &syncedRepo.Name,
-						FileName:       &file.Name,
-						Hunks:          []diff.Hunk{hunk},
-					})
-				}
+				conf.AddIgnoredHunk(syncedRepo, file.Name, ruleHunk)
+				differing--
 			case "h":
 				fmt.Printf(`Enter one of the following characters:
   - Y (accept all hunks for %s - applies only to %s repository)
@@ -201,21 +340,52 @@ hunkLoop:
 	}
 	unifiedFmt.Hunks = resultHunks
 	if len(unifiedFmt.Hunks) == 0 {
-		return false, nil
+		return differing, 0, nil
 	}
 	switch command {
 	case CommandDiff:
 		patch := unifiedFmt.String(true)
 		sep := getPrintSeparator(strings.Split(patch, "\n"))
 		fmt.Printf("%s\n%s", sep, patch)
-		return false, nil
-	case CommandSync:
+		return differing, 0, nil
+	case CommandSync, CommandUpstream:
 		patch := unifiedFmt.String(false)
-		if err = applyPatch(syncedRepoFilePath, patch); err != nil {
-			return false, err
+		if err = applyPatch(targetFilePath, patch); err != nil {
+			return 0, 0, err
 		}
 	}
-	return true, nil
+	return differing, len(unifiedFmt.Hunks), nil
+}
+
+// renderRootFile executes the root file as a [template.Template] with the synchronized
+// repository's variables and writes the result into a temporary file, returning its path.
+// It is the caller's responsibility to remove the file.
+func renderRootFile(rootFilePath string, repo *config.Repository) (string, error) {
+	// #nosec G304
+	data, err := os.ReadFile(rootFilePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read root file: %w", err)
+	}
+	tpl, err := template.New(filepath.Base(rootFilePath)).
+		Option("missingkey=error").
+		Parse(string(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse root file template: %w", err)
+	}
+	f, err := os.CreateTemp("", "gitsync-*-"+filepath.Base(rootFilePath))
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file for rendered root file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	vars := repo.Vars
+	if vars == nil {
+		vars = make(map[string]string)
+	}
+	if err = tpl.Execute(f, vars); err != nil {
+		_ = os.Remove(f.Name())
+		return "", fmt.Errorf("failed to render root file template for %s repository: %w", repo.Name, err)
+	}
+	return f.Name(), nil
 }
 
 func applyPatch(path, patch string) error {
@@ -237,163 +407,396 @@ func applyPatch(path, patch string) error {
 	return nil
 }
 
-type commitDetails struct {
-	Title string
-	Body  string
-}
-
-func commitChanges(root, repo *config.Repository, changedFiles []string) (*commitDetails, error) {
+// commitChanges checks out the sync branch, keeping the working tree changes, and commits them.
+func commitChanges(repo *config.Repository, details *changeDetails) error {
 	path := repo.GetPath()
-	fmt.Printf("%s: adding changes to the index\n", repo.Name)
+	fmt.Printf("%s: checking out %s branch\n", repo.Name, details.Branch)
 	if _, err := execCmd(
 		"git",
 		"-C", path,
-		"add",
-		"--all",
+		"checkout",
+		"-B",
+		details.Branch,
 	); err != nil {
-		return nil, fmt.Errorf("failed to add changes to the index: %w", err)
+		return fmt.Errorf("failed to create/reset gitsync branch: %w", err)
 	}
-	fmt.Printf("%s: committing changes\n", repo.Name)
-	message := commitBaseMessage
-	var body strings.Builder
-	body.WriteString("Synced the following files:\n\n")
-	for _, file := range changedFiles {
-		body.WriteString(fmt.Sprintf("- %s\n", file))
-	}
-	body.WriteString(fmt.Sprintf("\nRoot repository ref: %s\n", strings.TrimSuffix(root.URL, ".git")))
-	bodyStr := body.String()
+	fmt.Printf("%s: adding changes to the index\n", repo.Name)
 	if _, err := execCmd(
 		"git",
 		"-C", path,
-		"commit",
-		"-m", message,
-		"-m", bodyStr,
+		"add",
+		"--all",
 	); err != nil {
-		return nil, fmt.Errorf("failed to commit changes: %w", err)
+		return fmt.Errorf("failed to add changes to the index: %w", err)
+	}
+	fmt.Printf("%s: committing changes\n", repo.Name)
+	args := []string{"commit", "-m", details.CommitTitle}
+	if strings.TrimSpace(details.CommitBody) != "" {
+		args = append(args, "-m", details.CommitBody)
+	}
+	for _, trailer := range repo.GetCommitOptions().Trailers {
+		args = append(args, "--trailer", trailer)
 	}
-	return &commitDetails{
-		Title: message,
-		Body:  bodyStr,
-	}, nil
+	if _, err := gitCommit(repo, nil, args...); err != nil {
+		return fmt.Errorf("failed to commit changes: %w", err)
+	}
+	return nil
 }
 
-func pushChanges(repo *config.Repository) error {
-	path := repo.GetPath()
-	fmt.Printf("%s: pushing changes to remote\n", repo.Name)
-	if _, err := execCmd(
-		"git",
-		"-C", path,
-		"push",
-		"--force",
-		"-u",
-		"origin",
-		gitsyncUpdateBranch,
-	); err != nil {
-		return fmt.Errorf("failed to push changes to remote: %w", err)
+// gitCommit executes the git command which creates a commit, either 'commit' or 'commit-tree',
+// with the author, committer and signing of the repository's [config.CommitOptions].
+func gitCommit(repo *config.Repository, stdin io.Reader, args ...string) (*bytes.Buffer, error) {
+	opts := repo.GetCommitOptions()
+	cmd := newCmd()
+	if stdin != nil {
+		cmd.SetStdin(stdin)
 	}
+	if author := opts.Author; author != nil {
+		cmd.WithEnv("GIT_AUTHOR_NAME", author.Name).
+			WithEnv("GIT_AUTHOR_EMAIL", author.Email)
+	}
+	if committer := cmp.Or(opts.Committer, opts.Author); committer != nil {
+		cmd.WithEnv("GIT_COMMITTER_NAME", committer.Name).
+			WithEnv("GIT_COMMITTER_EMAIL", committer.Email)
+	}
+	gitArgs := []string{"-C", repo.GetPath()}
+	if signing := opts.Signing; signing != nil {
+		format := "openpgp"
+		if signing.Format == config.SigningFormatSSH {
+			format = "ssh"
+		}
+		gitArgs = append(gitArgs, "-c", "gpg.format="+format)
+		if signing.Key != "" {
+			args = append(args, "--gpg-sign="+signing.Key)
+		} else {
+			args = append(args, "--gpg-sign")
+		}
+	}
+	return cmd.Exec("git", append(gitArgs, args...)...)
+}
+
+// printChangeDetails prints the changes which would be committed, pushed and opened as a pull request.
+func printChangeDetails(repo *config.Repository, details *changeDetails) error {
+	status, err := execCmd("git", "-C", repo.GetPath(), "status", "--short")
+	if err != nil {
+		return fmt.Errorf("failed to get repository status: %w", err)
+	}
+	commitMessage := details.CommitTitle
+	if body := strings.TrimSpace(details.CommitBody); body != "" {
+		commitMessage += "\n\n" + body
+	}
+	sections := []string{
+		"Branch: " + details.Branch,
+		"Changed files:\n" + strings.TrimRight(status.String(), "\n"),
+		"Commit message:\n" + commitMessage,
+		"Pull request title: " + details.PullRequestTitle,
+		"Pull request body:\n" + strings.TrimSpace(details.PullRequestBody),
+	}
+	sep := getPrintSeparator(strings.Split(strings.Join(sections, "\n"), "\n"))
+	fmt.Printf("%s: dry run, the changes are not committed\n%s\n%s\n%s\n",
+		repo.Name, sep, strings.Join(sections, "\n\n"), sep)
 	return nil
 }
 
-type ghPullRequest struct {
-	Title string `json:"title"`
-	URL   string `json:"url"`
+// resetCheckout discards all the uncommitted changes of the repository's checkout, including untracked files.
+func resetCheckout(repo *config.Repository) error {
+	path := repo.GetPath()
+	if _, err := execCmd("git", "-C", path, "reset", "--hard", "--quiet", "HEAD"); err != nil {
+		return fmt.Errorf("failed to reset repository checkout: %w", err)
+	}
+	if _, err := execCmd("git", "-C", path, "clean", "-d", "--force", "--quiet"); err != nil {
+		return fmt.Errorf("failed to remove untracked files from repository checkout: %w", err)
+	}
+	return nil
 }
 
-func openPullRequest(repo *config.Repository, commit *commitDetails) error {
-	ref := repo.GetRef()
-	u, err := url.Parse(repo.URL)
+// openPullRequest opens a pull request for the sync branch and returns its number.
+// If the pull request already exists, its title and body are updated to describe the latest changes.
+// If it was closed without merging, it is reopened, or if that's not possible, a new one is opened.
+// The existing pull request is matched by its head and base branches, the number of the pull request
+// opened by the previous sync, if known, is checked first.
+func openPullRequest(f forge, repo *config.Repository, details *changeDetails, knownNumber int) (int, error) {
+	u, err := giturl.Parse(repo.URL)
 	if err != nil {
-		return fmt.Errorf("failed to parse repository URL: %w", err)
+		return 0, err
+	}
+	if u.IsLocal() {
+		return 0, fmt.Errorf("pull requests cannot be opened for a local repository: %s", repo.URL)
 	}
-	ghRepo := filepath.Join(u.Host, strings.TrimSuffix(u.Path, ".git"))
-	out, err := execCmd("gh", "auth", "token")
+	head, err := headRepository(f, repo, u)
 	if err != nil {
-		return fmt.Errorf("failed to get GitHub token: %w", err)
+		return 0, err
 	}
-	ghToken := strings.TrimSpace(out.String())
-	out, err = newCmd().
-		WithEnv("GH_TOKEN", ghToken).
-		Exec(
-			"gh",
-			"-R", ghRepo,
-			"pr",
-			"list",
-			"--search", commitBaseMessage,
-			"--json", "title,url",
-		)
+	existing, err := findPullRequest(f, u, head, details.Branch, trackedBranch(repo), knownNumber)
 	if err != nil {
-		return fmt.Errorf("failed to list GitHub pull requests: %w", err)
+		return 0, err
 	}
-	var prs []ghPullRequest
-	if err = json.Unmarshal(out.Bytes(), &prs); err != nil {
-		return fmt.Errorf("failed to unmarshal GitHub pull requests list response: %w", err)
+	if existing != nil && existing.State == pullRequestClosed {
+		fmt.Printf("%s: reopening closed pull request (%s)\n", repo.Name, existing.URL)
+		if err = f.ReopenPullRequest(u, existing.Number); err != nil {
+			fmt.Printf("%s: failed to reopen pull request, opening a new one: %v\n", repo.Name, err)
+			existing = nil
+		}
 	}
-	if len(prs) > 0 {
-		for _, pr := range prs {
-			if pr.Title == commit.Title {
-				fmt.Printf("%s: pull request already exists, skipping creation (%s)\n", repo.Name, pr.URL)
-				return nil
+	opts := repo.GetPullRequestOptions()
+	reviewers := slices.Concat(opts.Reviewers, opts.TeamReviewers)
+	if existing == nil {
+		fmt.Printf("%s: opening GitHub pull request\n", repo.Name)
+		existing, err = f.CreatePullRequest(u, newPullRequest{
+			Title:     details.PullRequestTitle,
+			Body:      details.PullRequestBody,
+			Base:      trackedBranch(repo),
+			Head:      details.Branch,
+			HeadOwner: forkOwner(repo, head),
+			Reviewers: reviewers,
+			Labels:    opts.Labels,
+			Assignees: opts.Assignees,
+			Draft:     opts.IsDraft(),
+		})
+		if err != nil {
+			return 0, err
+		}
+		fmt.Printf("%s: pull request URL: %s\n", repo.Name, existing.URL)
+	} else {
+		assignees, err := resolveCurrentUser(f, opts.Assignees)
+		if err != nil {
+			return 0, err
+		}
+		update := pullRequestUpdate{
+			Title:        details.PullRequestTitle,
+			Body:         details.PullRequestBody,
+			AddLabels:    missingNames(opts.Labels, existing.Labels),
+			AddReviewers: missingNames(reviewers, existing.Reviewers),
+			AddAssignees: missingNames(assignees, existing.Assignees),
+		}
+		if existing.Title == update.Title && existing.Body == update.Body &&
+			len(update.AddLabels)+len(update.AddReviewers)+len(update.AddAssignees) == 0 {
+			fmt.Printf("%s: pull request is up to date (%s)\n", repo.Name, existing.URL)
+		} else {
+			fmt.Printf("%s: updating pull request (%s)\n", repo.Name, existing.URL)
+			if err = f.UpdatePullRequest(u, existing.Number, update); err != nil {
+				return 0, err
+			}
+		}
+		if opts.Draft != nil && *opts.Draft != existing.IsDraft {
+			if *opts.Draft {
+				fmt.Printf("%s: converting pull request to draft (%s)\n", repo.Name, existing.URL)
+			} else {
+				fmt.Printf("%s: marking pull request as ready for review (%s)\n", repo.Name, existing.URL)
+			}
+			if err = f.SetPullRequestDraft(u, existing.Number, *opts.Draft); err != nil {
+				return 0, err
 			}
 		}
 	}
-	fmt.Printf("%s: opening GitHub pull request\n", repo.Name)
-	body := commit.Body
-	body += fmt.Sprintf("\nPull request generated by [gitsync](%s)", gitsyncURL)
-	out, err = newCmd().
-		WithEnv("GH_TOKEN", ghToken).
-		Exec(
-			"gh",
-			"-R", ghRepo,
-			"pr",
-			"create",
-			"--title", commit.Title,
-			"--body", body,
-			"--assignee", "@me",
-			// It's vital to remove the "origin/" prefix.
-			// Otherwise, the GitHub CLI will fail to create a pull request,
-			// as it can only accept a direct branch name.
-			"--base", strings.TrimPrefix(ref, "origin/"),
-			"--head", gitsyncUpdateBranch,
-		)
+	if opts.AutoMerge != "" && !existing.AutoMerge {
+		fmt.Printf("%s: enabling pull request auto-merge (%s)\n", repo.Name, opts.AutoMerge)
+		if err = f.EnableAutoMerge(u, existing.Number, opts.AutoMerge); err != nil {
+			return 0, err
+		}
+	}
+	return existing.Number, nil
+}
+
+// resolveCurrentUser replaces '@me' in the names with the authenticated user's login.
+func resolveCurrentUser(f forge, names []string) ([]string, error) {
+	if !slices.Contains(names, "@me") {
+		return names, nil
+	}
+	login, err := f.CurrentUser()
 	if err != nil {
-		return fmt.Errorf("failed to push changes to remote: %w", err)
+		return nil, err
 	}
-	prURL := strings.TrimSpace(out.String())
-	fmt.Printf("%s: pull request URL: %s\n", repo.Name, prURL)
-	return nil
+	resolved := make([]string, 0, len(names))
+	for _, name := range names {
+		if name == "@me" {
+			name = login
+		}
+		resolved = append(resolved, name)
+	}
+	return resolved, nil
 }
 
+// missingNames returns the names which are not present in the existing names.
+// Logins, team slugs and labels are compared case-insensitively, same as GitHub does.
+func missingNames(names, existing []string) []string {
+	var missing []string
+	for _, name := range names {
+		if !slices.ContainsFunc(existing, func(e string) bool { return strings.EqualFold(e, name) }) {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// closeObsoletePullRequest closes the open sync pull request of the repository which has no remaining
+// differences, e.g. because they were fixed by hand, and deletes its branch.
+func closeObsoletePullRequest(
+	f forge,
+	root, repo *config.Repository,
+	rootSHA string,
+	state *syncState,
+) error {
+	if repo.GetDelivery() != config.DeliveryPullRequest || !repo.GetPullRequestOptions().ShouldCloseObsolete() {
+		return nil
+	}
+	u, err := giturl.Parse(repo.URL)
+	if err != nil {
+		return err
+	}
+	if u.IsLocal() {
+		return nil
+	}
+	summary := newChangeSummary(root, repo, rootSHA, "", nil, nil)
+	head, err := headRepository(f, repo, u)
+	if err != nil {
+		return err
+	}
+	repoState := state.Repositories[repo.Name]
+	var pr *pullRequest
+	if repoState.PullRequest > 0 {
+		// The branch template might depend on the synchronized changes,
+		// the recorded pull request is the only reliable way of finding it.
+		if pr, err = f.GetPullRequest(u, repoState.PullRequest); err != nil {
+			return err
+		}
+		if !strings.EqualFold(pr.HeadOwner, head.Owner) || pr.BaseBranch != trackedBranch(repo) {
+			pr = nil
+		}
+	} else {
+		details, err := renderChangeDetails(summary)
+		if err != nil {
+			return err
+		}
+		if pr, err = findPullRequest(f, u, head, details.Branch, trackedBranch(repo), 0); err != nil {
+			return err
+		}
+	}
+	if pr == nil || pr.State != pullRequestOpen {
+		return nil
+	}
+	fmt.Printf("%s: closing obsolete pull request and deleting %s branch (%s)\n", repo.Name, pr.HeadBranch, pr.URL)
+	comment := fmt.Sprintf("The synchronized files are already up to date with %s at %s, "+
+		"closing the pull request as it is no longer needed.\n\n"+
+		"Closed by [gitsync](%s)", summary.RootURL, rootSHA, gitsyncURL)
+	if err = f.ClosePullRequest(u, pr.Number, comment); err != nil {
+		return err
+	}
+	if err = f.DeleteBranch(head, pr.HeadBranch); err != nil {
+		return err
+	}
+	repoState.PullRequest = 0
+	state.Repositories[repo.Name] = repoState
+	return state.save()
+}
+
+// findPullRequest returns the open, or if there's none, the most recently closed (but not merged)
+// pull request from the head repository's branch into the base branch.
+// If there's no such pull request, nil is returned.
+func findPullRequest(
+	f forge,
+	u, head *giturl.URL,
+	branch, base string,
+	knownNumber int,
+) (*pullRequest, error) {
+	matches := func(pr *pullRequest) bool {
+		return pr.HeadBranch == branch && strings.EqualFold(pr.HeadOwner, head.Owner) && pr.BaseBranch == base
+	}
+	if knownNumber > 0 {
+		pr, err := f.GetPullRequest(u, knownNumber)
+		if err == nil && matches(pr) && pr.State != pullRequestMerged {
+			return pr, nil
+		}
+	}
+	prs, err := f.ListPullRequests(u, branch, base)
+	if err != nil {
+		return nil, err
+	}
+	var found *pullRequest
+	for _, pr := range prs {
+		if !matches(&pr) {
+			continue
+		}
+		if pr.State == pullRequestOpen {
+			return &pr, nil
+		}
+		if pr.State == pullRequestClosed && found == nil {
+			found = &pr
+		}
+	}
+	return found, nil
+}
+
+// cloneRepo clones the repository into the store.
+// If the repository was already cloned, the existing checkout is verified and repaired if needed,
+// see [repairStoredRepo].
+// The new checkout is marked as created by gitsync, see [isManagedCheckout].
 func cloneRepo(repo *config.Repository) error {
 	path := repo.GetPath()
-	if info, err := os.Stat(path); err == nil && info.IsDir() {
-		return nil
+	if _, err := os.Lstat(path); err == nil {
+		reusable, err := repairStoredRepo(repo)
+		if err != nil {
+			return err
+		}
+		if reusable {
+			return nil
+		}
 	}
 	fmt.Printf("%s: cloning %s into %s\n", repo.Name, repo.URL, path)
-	if _, err := execCmd(
-		"git",
-		"clone",
-		"--",
-		repo.URL,
-		path,
-	); err != nil {
+	opts := repo.GetCloneOptions()
+	args := []string{"clone"}
+	if opts.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(opts.Depth))
+	}
+	if opts.Filter != "" {
+		args = append(args, "--filter", opts.Filter)
+	}
+	if opts.SingleBranch {
+		args = append(args, "--single-branch")
+		// Commits cannot be cloned directly, the default branch is cloned instead
+		// and the commit is fetched by updateTrackedRef.
+		if !commitSHARegex.MatchString(repo.GetRef()) {
+			args = append(args, "--branch", trackedBranch(repo))
+		}
+	}
+	if opts.Sparse {
+		// Files are checked out once the sparse checkout is configured.
+		args = append(args, "--no-checkout")
+	}
+	args = append(args, "--", repo.URL, path)
+	if _, err := execCmd("git", args...); err != nil {
 		return fmt.Errorf("failed to clone repository: %w", err)
 	}
-	return nil
+	return markManagedCheckout(path)
 }
 
-func updateTrackedRef(repo *config.Repository) error {
+// updateTrackedRef fetches the latest changes and force checks out the tracked ref,
+// discarding any uncommitted changes and untracked files left in the checkout.
+// If sparse checkout is enabled, only the provided paths are checked out.
+func updateTrackedRef(repo *config.Repository, sparsePaths []string) error {
 	path := repo.GetPath()
 	ref := repo.GetRef()
+	opts := repo.GetCloneOptions()
 	fmt.Printf("%s: updating repository ref (%s)\n", repo.Name, ref)
-	if _, err := execCmd(
-		"git",
-		"-C", path,
-		"fetch",
-		"--force",
-		"--all",
-	); err != nil {
+	args := []string{"-C", path, "fetch", "--force"}
+	if opts.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(opts.Depth))
+	}
+	if opts.SingleBranch {
+		refSpec, err := trackedRefSpec(repo)
+		if err != nil {
+			return err
+		}
+		args = append(args, "origin", refSpec)
+	} else {
+		args = append(args, "--all")
+	}
+	if _, err := execCmd("git", args...); err != nil {
 		return fmt.Errorf("failed to fetch repository objects and refs: %w", err)
 	}
+	if err := configureSparseCheckout(repo, sparsePaths); err != nil {
+		return err
+	}
 	if _, err := execCmd(
 		"git",
 		"-C", path,
@@ -412,27 +815,152 @@ func updateTrackedRef(repo *config.Repository) error {
 	); err != nil {
 		return fmt.Errorf("failed to hard reset repository to %s ref: %w", ref, err)
 	}
+	if _, err := execCmd(
+		"git",
+		"-C", path,
+		"clean",
+		"-d",
+		"--force",
+	); err != nil {
+		return fmt.Errorf("failed to remove untracked files from repository checkout: %w", err)
+	}
 	return nil
 }
 
-func checkoutSyncBranch(repo *config.Repository) error {
-	path := repo.GetPath()
+// commitSHARegex matches full SHA-1 and SHA-256 commit hashes.
+var commitSHARegex = regexp.MustCompile(`^([0-9a-f]{40}|[0-9a-f]{64})$`)
+
+// trackedRefSpec returns the refspec which fetches only the tracked ref.
+// Refs prefixed with 'origin/' are remote branches and full commit SHAs are fetched directly,
+// other refs are looked up in the remote repository, tags taking precedence over branches,
+// same as when resolving the ref locally.
+func trackedRefSpec(repo *config.Repository) (string, error) {
 	ref := repo.GetRef()
-	fmt.Printf("%s: checking out %s branch\n", repo.Name, gitsyncUpdateBranch)
+	branchRefSpec := func(branch string) string {
+		return fmt.Sprintf("+refs/heads/%[1]s:refs/remotes/origin/%[1]s", branch)
+	}
+	if branch, ok := strings.CutPrefix(ref, "origin/"); ok {
+		return branchRefSpec(branch), nil
+	}
+	if commitSHARegex.MatchString(ref) {
+		return ref, nil
+	}
+	out, err := execCmd("git", "-C", repo.GetPath(), "ls-remote", "origin", "refs/tags/"+ref, "refs/heads/"+ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up %s ref in the remote repository: %w", ref, err)
+	}
+	var isBranch bool
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		_, remoteRef, _ := strings.Cut(line, "\t")
+		switch remoteRef {
+		case "refs/tags/" + ref:
+			return fmt.Sprintf("+refs/tags/%[1]s:refs/tags/%[1]s", ref), nil
+		case "refs/heads/" + ref:
+			isBranch = true
+		}
+	}
+	if !isBranch {
+		return "", fmt.Errorf("%s ref is neither a branch, tag nor full commit SHA of the remote repository", ref)
+	}
+	return branchRefSpec(ref), nil
+}
+
+// configureSparseCheckout limits the checkout to the provided paths if sparse checkout is enabled for
+// the repository, otherwise it disables sparse checkout if it was previously configured.
+func configureSparseCheckout(repo *config.Repository, sparsePaths []string) error {
+	path := repo.GetPath()
+	if !repo.GetCloneOptions().Sparse {
+		out, err := newCmd().
+			SkipErroneousStatus(1).
+			Exec("git", "-C", path, "config", "--get", "core.sparseCheckout")
+		if err != nil || strings.TrimSpace(out.String()) != "true" {
+			return nil
+		}
+		if _, err = execCmd("git", "-C", path, "sparse-checkout", "disable"); err != nil {
+			return fmt.Errorf("failed to disable sparse checkout: %w", err)
+		}
+		return nil
+	}
 	if _, err := execCmd(
 		"git",
-		"-C", path,
-		"checkout",
-		"--force",
-		"-B",
-		gitsyncUpdateBranch,
-		ref,
+		append([]string{"-C", path, "sparse-checkout", "set", "--no-cone", "--"}, sparsePaths...)...,
 	); err != nil {
-		return fmt.Errorf("failed to create/reset gitsync branch: %w", err)
+		return fmt.Errorf("failed to configure sparse checkout: %w", err)
 	}
 	return nil
 }
 
+// headCommit returns the SHA of the commit checked out in the repository.
+func headCommit(repo *config.Repository) (string, error) {
+	out, err := execCmd("git", "-C", repo.GetPath(), "rev-parse", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s repository HEAD commit: %w", repo.Name, err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// rootCommitsSince returns the root repository commits which changed any of the files
+// since the previous commit (exclusive) up to the current one, newest first.
+// If the previous commit is not known or is not an ancestor of the current one,
+// e.g. because of a shallow clone or a force push, no commits are returned.
+func rootCommitsSince(
+	root *config.Repository,
+	previousSHA, currentSHA string,
+	files []syncedFile,
+) ([]rootCommit, error) {
+	if previousSHA == "" || previousSHA == currentSHA {
+		return nil, nil
+	}
+	path := root.GetPath()
+	if _, err := execCmd("git", "-C", path, "merge-base", "--is-ancestor", previousSHA, currentSHA); err != nil {
+		return nil, nil
+	}
+	args := []string{"-C", path, "log", "--format=%H%x00%s", previousSHA + ".." + currentSHA, "--"}
+	for _, file := range files {
+		args = append(args, file.Path)
+	}
+	out, err := execCmd("git", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list root repository commits: %w", err)
+	}
+	var commits []rootCommit
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		sha, subject, found := strings.Cut(line, "\x00")
+		if !found {
+			continue
+		}
+		commits = append(commits, rootCommit{
+			SHA:      sha,
+			ShortSHA: shortSHA(sha),
+			Subject:  subject,
+			URL:      commitURL(root.URL, sha),
+		})
+	}
+	return commits, nil
+}
+
+// trackedBranch returns the remote branch name of the tracked ref, e.g. 'main' for 'origin/main'.
+func trackedBranch(repo *config.Repository) string {
+	return strings.TrimPrefix(repo.GetRef(), "origin/")
+}
+
+// sparseCheckoutPaths returns the sparse checkout patterns matching the files synchronized with the repository.
+// For the root repository, files of all the synchronized repositories are matched.
+func sparseCheckoutPaths(conf *config.Config, repo *config.Repository, syncedRepos []*config.Repository) []string {
+	paths := make([]string, 0, len(conf.SyncFiles))
+	for _, file := range conf.SyncFiles {
+		matches := slices.ContainsFunc(syncedRepos, file.Matches)
+		if repo != conf.Root {
+			matches = file.Matches(repo)
+		}
+		if matches {
+			// Leading slash anchors the pattern to the repository root.
+			paths = append(paths, "/"+file.Path)
+		}
+	}
+	return paths
+}
+
 func getPrintSeparator(strs []string) string {
 	maxLineLen := len(slices.MaxFunc(
 		strs,
@@ -441,12 +969,20 @@ func getPrintSeparator(strs []string) string {
 	return strings.Repeat("=", maxLineLen)
 }
 
-func checkDependencies() error {
+// checkDependencies checks if the required programs are installed.
+// GitHub CLI is only required if any of the delivered repositories is interacted with through the forge API.
+// Read-only runs, diff and dry run, only need it to discover the repositories.
+func checkDependencies(conf *config.Config, repos []*config.Repository, readOnly bool) error {
 	if _, err := execCmd("git", "--version"); err != nil {
 		return errors.New("'git' is required to be installed")
 	}
-	if _, err := execCmd("gh", "--version"); err != nil {
-		return errors.New("'gh' (GitHub CLI) is required to be installed")
+	if readOnly {
+		repos = nil
+	}
+	if requiresForge(conf, repos) {
+		if _, err := execCmd("gh", "--version"); err != nil {
+			return errors.New("'gh' (GitHub CLI) is required to be installed")
+		}
 	}
 	if _, err := execCmd("diff", "--version"); err != nil {
 		return errors.New("'diff' (GNU) is required to be installed")
@@ -454,8 +990,34 @@ func checkDependencies() error {
 	return nil
 }
 
+// requiresForge reports whether the forge API is needed, either to discover the repositories,
+// to fork them or to open pull requests for them.
+// Repositories with [config.DeliveryLocal] are never forked.
+// Discovered repositories are not known yet, but discovering them requires the forge API anyway.
+func requiresForge(conf *config.Config, repos []*config.Repository) bool {
+	if len(conf.Discover) > 0 {
+		return true
+	}
+	for _, repo := range repos {
+		delivery := repo.GetDelivery()
+		if delivery == config.DeliveryLocal {
+			continue
+		}
+		if repo.Fork != nil {
+			return true
+		}
+		if delivery != config.DeliveryPullRequest {
+			continue
+		}
+		if u, err := giturl.Parse(repo.URL); err == nil && !u.IsLocal() {
+			return true
+		}
+	}
+	return false
+}
+
 type ignoreRulesQuery struct {
-	RepoName string
+	Repo     *config.Repository
 	FileName string
 	Hunk     bool
 	Regex    bool
@@ -467,7 +1029,10 @@ func getIgnoreRules(conf *config.Config, query ignoreRulesQuery) []*config.Ignor
 	}
 	rules := make([]*config.IgnoreRule, 0)
 	for _, ignore := range conf.Ignore {
-		if ignore.RepositoryName != nil && *ignore.RepositoryName != query.RepoName {
+		if ignore.RepositoryName != nil && *ignore.RepositoryName != query.Repo.Name {
+			continue
+		}
+		if !ignore.Matches(query.Repo) {
 			continue
 		}
 		if ignore.FileName != nil && *ignore.FileName != query.FileName {
@@ -482,3 +1047,16 @@ func getIgnoreRules(conf *config.Config, query ignoreRulesQuery) []*config.Ignor
 	}
 	return rules
 }
+
+func selectRepositories(conf *config.Config, tags []string) []*config.Repository {
+	if len(tags) == 0 {
+		return conf.Repositories
+	}
+	repos := make([]*config.Repository, 0, len(conf.Repositories))
+	for _, repo := range conf.Repositories {
+		if repo.HasAnyTag(tags...) {
+			repos = append(repos, repo)
+		}
+	}
+	return repos
+}
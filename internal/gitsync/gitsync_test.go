@@ -0,0 +1,1472 @@
+package gitsync
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nieomylnieja/gitsync/internal/config"
+	"github.com/nieomylnieja/gitsync/internal/giturl"
+)
+
+func TestUniqueRepositoryNames(t *testing.T) {
+	urls := make([]*giturl.URL, 0, 4)
+	for _, rawURL := range []string{
+		"https://github.com/nieomylnieja/go-repo-template.git",
+		"git@github.com:nieomylnieja/gitsync.git",
+		"https://gitlab.com/someone/gitsync",
+		"/home/nieomylnieja/go-libyear",
+	} {
+		u, err := giturl.Parse(rawURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		urls = append(urls, u)
+	}
+	names := uniqueRepositoryNames(urls)
+	expected := []string{"go-repo-template", "nieomylnieja-gitsync", "someone-gitsync", "go-libyear"}
+	if !slices.Equal(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
+
+func TestFileSimilarity(t *testing.T) {
+	root := []byte("linters:\n  enable:\n    - govet\n    - errcheck\n")
+	tests := map[string]struct {
+		data       string
+		similarity float64
+	}{
+		"same":      {data: string(root), similarity: 1},
+		"different": {data: "builds:\n  - main: ./cmd\n", similarity: 0},
+		"similar":   {data: "linters:\n  enable:\n    - govet\n    - lll\n", similarity: 0.75},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if similarity := fileSimilarity(root, []byte(test.data)); similarity != test.similarity {
+				t.Errorf("expected %f, got %f", test.similarity, similarity)
+			}
+		})
+	}
+}
+
+type fakeForge struct {
+	repos     []forgeRepository
+	prs       []pullRequest
+	reopenErr error
+	// forkURL is the URL of the repository returned by ForkRepository.
+	forkURL string
+	// Recorded calls.
+	created    []newPullRequest
+	updated    []int
+	updates    []pullRequestUpdate
+	reopened   []int
+	closed     []int
+	deleted    []string
+	forked     []string
+	drafts     map[int]bool
+	autoMerged []int
+}
+
+func (f *fakeForge) ListRepositories(string) ([]forgeRepository, error) {
+	return f.repos, nil
+}
+
+func (f *fakeForge) ListPullRequests(_ *giturl.URL, head, base string) ([]pullRequest, error) {
+	var prs []pullRequest
+	for _, pr := range f.prs {
+		if pr.HeadBranch == head && pr.BaseBranch == base {
+			prs = append(prs, pr)
+		}
+	}
+	return prs, nil
+}
+
+func (f *fakeForge) GetPullRequest(_ *giturl.URL, number int) (*pullRequest, error) {
+	for _, pr := range f.prs {
+		if pr.Number == number {
+			return &pr, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func (f *fakeForge) CreatePullRequest(_ *giturl.URL, pr newPullRequest) (*pullRequest, error) {
+	f.created = append(f.created, pr)
+	return &pullRequest{
+		Number:     100,
+		State:      pullRequestOpen,
+		HeadBranch: pr.Head,
+		HeadOwner:  cmp.Or(pr.HeadOwner, "nieomylnieja"),
+		BaseBranch: pr.Base,
+	}, nil
+}
+
+func (f *fakeForge) UpdatePullRequest(_ *giturl.URL, number int, update pullRequestUpdate) error {
+	f.updated = append(f.updated, number)
+	f.updates = append(f.updates, update)
+	return nil
+}
+
+func (f *fakeForge) ReopenPullRequest(_ *giturl.URL, number int) error {
+	if f.reopenErr != nil {
+		return f.reopenErr
+	}
+	f.reopened = append(f.reopened, number)
+	return nil
+}
+
+func (f *fakeForge) ClosePullRequest(_ *giturl.URL, number int, _ string) error {
+	f.closed = append(f.closed, number)
+	return nil
+}
+
+func (f *fakeForge) DeleteBranch(repo *giturl.URL, branch string) error {
+	f.deleted = append(f.deleted, repo.FullName()+":"+branch)
+	return nil
+}
+
+func (f *fakeForge) ForkRepository(_ *giturl.URL, owner, name string) (*forgeRepository, error) {
+	f.forked = append(f.forked, owner+"/"+name)
+	return &forgeRepository{Name: name, URL: f.forkURL, SSHURL: f.forkURL}, nil
+}
+
+func (f *fakeForge) SetPullRequestDraft(_ *giturl.URL, number int, draft bool) error {
+	if f.drafts == nil {
+		f.drafts = make(map[int]bool)
+	}
+	f.drafts[number] = draft
+	return nil
+}
+
+func (f *fakeForge) EnableAutoMerge(_ *giturl.URL, number int, _ config.MergeMethod) error {
+	f.autoMerged = append(f.autoMerged, number)
+	return nil
+}
+
+func (f *fakeForge) CurrentUser() (string, error) {
+	return "nieomylnieja", nil
+}
+
+func TestDiscoverRepositories(t *testing.T) {
+	f := &fakeForge{repos: []forgeRepository{
+		{
+			Name:          "go-libyear",
+			URL:           "https://github.com/nieomylnieja/go-libyear.git",
+			DefaultBranch: "main",
+			Topics:        []string{"go"},
+		},
+		{Name: "go-archived", URL: "https://github.com/nieomylnieja/go-archived.git", Topics: []string{"go"},
+			IsArchived: true},
+		{Name: "go-fork", URL: "https://github.com/nieomylnieja/go-fork.git", Topics: []string{"go"}, IsFork: true},
+		{Name: "go-untagged", URL: "https://github.com/nieomylnieja/go-untagged.git"},
+		{Name: "sword-to-obsidian", URL: "https://github.com/nieomylnieja/sword-to-obsidian.git", Topics: []string{"go"}},
+	}}
+	repos, err := discoverRepositories(f, &config.Discovery{
+		Owner:     "nieomylnieja",
+		Topic:     "go",
+		NameRegex: "^go-",
+		Tags:      []string{"library"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 1 {
+		t.Fatalf("expected 1 repository, got %d", len(repos))
+	}
+	repo := repos[0]
+	if repo.Name != "go-libyear" || repo.Ref != "origin/main" || !slices.Equal(repo.Tags, []string{"library"}) {
+		t.Errorf("unexpected repository: %+v", repo)
+	}
+}
+
+func TestOpenPullRequest(t *testing.T) {
+	repo := &config.Repository{Name: "go-libyear", URL: "git@github.com:nieomylnieja/go-libyear.git"}
+	if _, err := config.New("config.json", repo, nil); err != nil {
+		t.Fatal(err)
+	}
+	details := &changeDetails{
+		Branch:           "gitsync-update",
+		PullRequestTitle: "chore: gitsync update",
+		PullRequestBody:  "Synced the following files:\n\n- .golangci.yml\n",
+	}
+	syncPR := func(number int, state pullRequestState) pullRequest {
+		return pullRequest{
+			Number:     number,
+			Title:      "Retitled by a human",
+			State:      state,
+			HeadBranch: details.Branch,
+			HeadOwner:  "nieomylnieja",
+			BaseBranch: "main",
+		}
+	}
+	tests := map[string]struct {
+		prs         []pullRequest
+		knownNumber int
+		reopenErr   error
+		number      int
+		created     int
+		updated     []int
+		reopened    []int
+	}{
+		"no pull request": {
+			number:  100,
+			created: 1,
+		},
+		"pull request from another branch": {
+			prs: []pullRequest{{
+				Number:     1,
+				Title:      details.PullRequestTitle,
+				State:      pullRequestOpen,
+				HeadBranch: "feature",
+				HeadOwner:  "nieomylnieja",
+				BaseBranch: "main",
+			}},
+			number:  100,
+			created: 1,
+		},
+		"open pull request": {
+			prs:     []pullRequest{syncPR(1, pullRequestOpen)},
+			number:  1,
+			updated: []int{1},
+		},
+		"up to date pull request": {
+			prs: []pullRequest{{
+				Number:     1,
+				Title:      details.PullRequestTitle,
+				Body:       details.PullRequestBody,
+				State:      pullRequestOpen,
+				HeadBranch: details.Branch,
+				HeadOwner:  "nieomylnieja",
+				BaseBranch: "main",
+				Assignees:  []string{"nieomylnieja"},
+			}},
+			number: 1,
+		},
+		"known pull request": {
+			prs:         []pullRequest{syncPR(3, pullRequestOpen), syncPR(2, pullRequestOpen)},
+			knownNumber: 2,
+			number:      2,
+			updated:     []int{2},
+		},
+		"closed pull request": {
+			prs:      []pullRequest{syncPR(2, pullRequestClosed), syncPR(1, pullRequestMerged)},
+			number:   2,
+			updated:  []int{2},
+			reopened: []int{2},
+		},
+		"closed pull request which cannot be reopened": {
+			prs:       []pullRequest{syncPR(2, pullRequestClosed)},
+			reopenErr: errors.New("branch was force-pushed"),
+			number:    100,
+			created:   1,
+		},
+		"merged pull request": {
+			prs:         []pullRequest{syncPR(1, pullRequestMerged)},
+			knownNumber: 1,
+			number:      100,
+			created:     1,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := &fakeForge{prs: test.prs, reopenErr: test.reopenErr}
+			number, err := openPullRequest(f, repo, details, test.knownNumber)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if number != test.number {
+				t.Errorf("expected pull request number %d, got %d", test.number, number)
+			}
+			if len(f.created) != test.created {
+				t.Errorf("expected %d pull requests to be created, got %d", test.created, len(f.created))
+			}
+			if !slices.Equal(f.updated, test.updated) {
+				t.Errorf("expected %v pull requests to be updated, got %v", test.updated, f.updated)
+			}
+			if !slices.Equal(f.reopened, test.reopened) {
+				t.Errorf("expected %v pull requests to be reopened, got %v", test.reopened, f.reopened)
+			}
+		})
+	}
+}
+
+func TestOpenPullRequest_Options(t *testing.T) {
+	draft := true
+	repo := &config.Repository{
+		Name: "go-libyear",
+		URL:  "git@github.com:nieomylnieja/go-libyear.git",
+		PullRequest: &config.PullRequestOptions{
+			Labels:        []string{"dependencies", "gitsync"},
+			Reviewers:     []string{"octocat", "hubot"},
+			TeamReviewers: []string{"nieomylnieja/maintainers"},
+			Draft:         &draft,
+			AutoMerge:     config.MergeMethodSquash,
+		},
+	}
+	if _, err := config.New("config.json", repo, nil); err != nil {
+		t.Fatal(err)
+	}
+	details := &changeDetails{
+		Branch:           "gitsync-update",
+		PullRequestTitle: "chore: gitsync update",
+		PullRequestBody:  "Synced the following files:\n\n- .golangci.yml\n",
+	}
+
+	t.Run("create", func(t *testing.T) {
+		f := &fakeForge{}
+		if _, err := openPullRequest(f, repo, details, 0); err != nil {
+			t.Fatal(err)
+		}
+		if len(f.created) != 1 {
+			t.Fatalf("expected a pull request to be created, got %d", len(f.created))
+		}
+		created := f.created[0]
+		if !slices.Equal(created.Labels, []string{"dependencies", "gitsync"}) {
+			t.Errorf("unexpected labels: %v", created.Labels)
+		}
+		if !slices.Equal(created.Reviewers, []string{"octocat", "hubot", "nieomylnieja/maintainers"}) {
+			t.Errorf("unexpected reviewers: %v", created.Reviewers)
+		}
+		if !slices.Equal(created.Assignees, []string{"@me"}) {
+			t.Errorf("unexpected assignees: %v", created.Assignees)
+		}
+		if !created.Draft {
+			t.Error("expected a draft pull request")
+		}
+		if !slices.Equal(f.autoMerged, []int{100}) {
+			t.Errorf("expected auto-merge to be enabled, got %v", f.autoMerged)
+		}
+	})
+	t.Run("update", func(t *testing.T) {
+		f := &fakeForge{prs: []pullRequest{{
+			Number:     1,
+			Title:      details.PullRequestTitle,
+			Body:       details.PullRequestBody,
+			State:      pullRequestOpen,
+			HeadBranch: details.Branch,
+			HeadOwner:  "nieomylnieja",
+			BaseBranch: "main",
+			Labels:     []string{"GitSync"},
+			// Hubot has already reviewed the pull request, it must not be requested again.
+			Reviewers: []string{"hubot", "nieomylnieja/maintainers"},
+			AutoMerge: true,
+		}}}
+		if _, err := openPullRequest(f, repo, details, 1); err != nil {
+			t.Fatal(err)
+		}
+		if len(f.updates) != 1 {
+			t.Fatalf("expected the pull request to be updated, got %d updates", len(f.updates))
+		}
+		update := f.updates[0]
+		if !slices.Equal(update.AddLabels, []string{"dependencies"}) {
+			t.Errorf("unexpected added labels: %v", update.AddLabels)
+		}
+		if !slices.Equal(update.AddReviewers, []string{"octocat"}) {
+			t.Errorf("unexpected added reviewers: %v", update.AddReviewers)
+		}
+		if !slices.Equal(update.AddAssignees, []string{"nieomylnieja"}) {
+			t.Errorf("unexpected added assignees: %v", update.AddAssignees)
+		}
+		if len(f.autoMerged) != 0 {
+			t.Errorf("expected auto-merge not to be enabled again, got %v", f.autoMerged)
+		}
+		if draft, ok := f.drafts[1]; !ok || !draft {
+			t.Errorf("expected the pull request to be converted to draft, got %v", f.drafts)
+		}
+	})
+}
+
+func TestOpenPullRequest_Fork(t *testing.T) {
+	repo := &config.Repository{
+		Name: "go-libyear",
+		URL:  "git@github.com:upstream/go-libyear.git",
+		Fork: &config.ForkOptions{},
+	}
+	if _, err := config.New("config.json", repo, nil); err != nil {
+		t.Fatal(err)
+	}
+	details := &changeDetails{Branch: "gitsync-update", PullRequestTitle: "chore: gitsync update"}
+	upstreamPR := pullRequest{
+		Number:     1,
+		Title:      details.PullRequestTitle,
+		State:      pullRequestOpen,
+		HeadBranch: details.Branch,
+		HeadOwner:  "upstream",
+		BaseBranch: "main",
+	}
+	f := &fakeForge{prs: []pullRequest{upstreamPR}}
+	number, err := openPullRequest(f, repo, details, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if number != 100 || len(f.created) != 1 {
+		t.Fatalf("expected a new pull request to be created, got %d (%d created)", number, len(f.created))
+	}
+	if owner := f.created[0].HeadOwner; owner != "nieomylnieja" {
+		t.Errorf("expected the pull request to be opened from nieomylnieja fork, got %q", owner)
+	}
+}
+
+func TestCloseObsoletePullRequest(t *testing.T) {
+	root := &config.Repository{Name: "template", URL: "git@github.com:nieomylnieja/go-repo-template.git"}
+	keepOpen := false
+	repos := map[string]*config.Repository{
+		"default": {Name: "go-libyear", URL: "git@github.com:nieomylnieja/go-libyear.git"},
+		"disabled": {
+			Name:        "go-libyear",
+			URL:         "git@github.com:nieomylnieja/go-libyear.git",
+			PullRequest: &config.PullRequestOptions{CloseObsolete: &keepOpen},
+		},
+		"templated branch": {
+			Name:      "go-libyear",
+			URL:       "git@github.com:nieomylnieja/go-libyear.git",
+			Templates: &config.Templates{Branch: "gitsync-{{ .ShortRootSHA }}"},
+		},
+	}
+	for _, repo := range repos {
+		if _, err := config.New("config.json", root, []*config.Repository{repo}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	syncPR := func(state pullRequestState) pullRequest {
+		return pullRequest{
+			Number:     1,
+			State:      state,
+			HeadBranch: "gitsync-update",
+			HeadOwner:  "nieomylnieja",
+			BaseBranch: "main",
+		}
+	}
+	tests := map[string]struct {
+		repo       string
+		unrecorded bool
+		prs        []pullRequest
+		closed     []int
+		deleted    []string
+	}{
+		"open pull request": {
+			repo:    "default",
+			prs:     []pullRequest{syncPR(pullRequestOpen)},
+			closed:  []int{1},
+			deleted: []string{"nieomylnieja/go-libyear:gitsync-update"},
+		},
+		"unrecorded pull request": {
+			repo:       "default",
+			unrecorded: true,
+			prs:        []pullRequest{syncPR(pullRequestOpen)},
+			closed:     []int{1},
+			deleted:    []string{"nieomylnieja/go-libyear:gitsync-update"},
+		},
+		"recorded pull request with templated branch": {
+			repo: "templated branch",
+			prs: []pullRequest{func() pullRequest {
+				// Branch rendered for a previous root commit.
+				pr := syncPR(pullRequestOpen)
+				pr.HeadBranch = "gitsync-abcdef0"
+				return pr
+			}()},
+			closed:  []int{1},
+			deleted: []string{"nieomylnieja/go-libyear:gitsync-abcdef0"},
+		},
+		"closed pull request": {
+			repo: "default",
+			prs:  []pullRequest{syncPR(pullRequestClosed)},
+		},
+		"closing disabled": {
+			repo: "disabled",
+			prs:  []pullRequest{syncPR(pullRequestOpen)},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			repo := repos[test.repo]
+			recorded := 1
+			if test.unrecorded {
+				recorded = 0
+			}
+			state := &syncState{
+				Repositories: map[string]repositoryState{repo.Name: {PullRequest: recorded}},
+				path:         filepath.Join(t.TempDir(), stateFileName),
+			}
+			f := &fakeForge{prs: test.prs}
+			if err := closeObsoletePullRequest(f, root, repo, "0123456789", state); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(f.closed, test.closed) {
+				t.Errorf("expected %v pull requests to be closed, got %v", test.closed, f.closed)
+			}
+			if !slices.Equal(f.deleted, test.deleted) {
+				t.Errorf("expected %v branches to be deleted, got %v", test.deleted, f.deleted)
+			}
+			if number := state.Repositories[repo.Name].PullRequest; len(test.closed) > 0 && number != 0 {
+				t.Errorf("expected the closed pull request to be removed from the state, got %d", number)
+			}
+		})
+	}
+}
+
+func TestVerifyFork(t *testing.T) {
+	repo := &giturl.URL{Host: "github.com", Owner: "nieomylnieja", Name: "go-libyear"}
+	fork := &giturl.URL{Host: "github.com", Owner: "octocat", Name: "go-libyear"}
+	tests := map[string]struct {
+		existing forgeRepository
+		err      string
+	}{
+		"fork": {
+			existing: forgeRepository{IsFork: true, Parent: "NieOmylNieJa/go-libyear"},
+		},
+		"not a fork": {
+			existing: forgeRepository{},
+			err:      "repository octocat/go-libyear already exists and is not a fork of nieomylnieja/go-libyear",
+		},
+		"fork of another repository": {
+			existing: forgeRepository{IsFork: true, Parent: "someone/go-libyear"},
+			err:      "repository octocat/go-libyear is a fork of someone/go-libyear, not nieomylnieja/go-libyear",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := verifyFork(&test.existing, fork, repo)
+			switch {
+			case test.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case test.err != "" && (err == nil || err.Error() != test.err):
+				t.Errorf("expected error %q, got: %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestSyncRepoFile_Template(t *testing.T) {
+	tests := map[string]struct {
+		template   bool
+		vars       map[string]string
+		rootData   string
+		syncedData string
+		differing  int
+		err        string
+	}{
+		"template rendered with repository variables": {
+			template:   true,
+			vars:       map[string]string{"Module": "github.com/nieomylnieja/go-libyear"},
+			rootData:   "module {{ .Module }}\n",
+			syncedData: "module github.com/nieomylnieja/go-libyear\n",
+		},
+		"template differing from the synchronized file": {
+			template:   true,
+			vars:       map[string]string{"Module": "github.com/nieomylnieja/go-libyear"},
+			rootData:   "module {{ .Module }}\n",
+			syncedData: "module github.com/nieomylnieja/go-repo-template\n",
+			differing:  1,
+		},
+		"missing variable": {
+			template:   true,
+			rootData:   "module {{ .Module }}\n",
+			syncedData: "module github.com/nieomylnieja/go-libyear\n",
+			err:        `map has no entry for key "Module"`,
+		},
+		"not a template": {
+			vars:       map[string]string{"Module": "github.com/nieomylnieja/go-libyear"},
+			rootData:   "module {{ .Module }}\n",
+			syncedData: "module {{ .Module }}\n",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			conf := readTestConfig(t, dir, filepath.Join(dir, "origin"), "")
+			repo, file := conf.Repositories[0], conf.SyncFiles[0]
+			repo.Vars = test.vars
+			file.Template = test.template
+			rootFilePath := filepath.Join(dir, "root", file.Path)
+			syncedFilePath := filepath.Join(conf.GetStorePath(), repo.Name, file.Path)
+			for path, data := range map[string]string{rootFilePath: test.rootData, syncedFilePath: test.syncedData} {
+				if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			differing, _, err := syncRepoFile(conf, CommandDiff, repo, file, rootFilePath)
+			switch {
+			case test.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Fatalf("expected error containing %q, got: %v", test.err, err)
+			}
+			if differing != test.differing {
+				t.Errorf("expected %d differing hunks, got %d", test.differing, differing)
+			}
+			if data, err := os.ReadFile(rootFilePath); err != nil || string(data) != test.rootData {
+				t.Errorf("expected root file to be left unchanged, got %q: %v", data, err)
+			}
+		})
+	}
+}
+
+func TestWebLinks(t *testing.T) {
+	const sha = "4f2c1a9d0e8b7c6a5f4e3d2c1b0a9f8e7d6c5b4a"
+	tests := map[string]struct {
+		repoURL string
+		web     string
+		commit  string
+		file    string
+	}{
+		"github": {
+			repoURL: "git@github.com:nieomylnieja/go-repo-template.git",
+			web:     "https://github.com/nieomylnieja/go-repo-template",
+			commit:  "https://github.com/nieomylnieja/go-repo-template/commit/" + sha,
+			file:    "https://github.com/nieomylnieja/go-repo-template/blob/" + sha + "/.golangci.yml",
+		},
+		"custom host and port": {
+			repoURL: "http://git.example.com:8080/platform/go-repo-template.git",
+			web:     "http://git.example.com:8080/platform/go-repo-template",
+			commit:  "http://git.example.com:8080/platform/go-repo-template/commit/" + sha,
+			file:    "http://git.example.com:8080/platform/go-repo-template/blob/" + sha + "/.golangci.yml",
+		},
+		"gitlab": {
+			repoURL: "https://gitlab.example.com:8443/group/subgroup/go-repo-template.git",
+			web:     "https://gitlab.example.com:8443/group/subgroup/go-repo-template",
+			commit:  "https://gitlab.example.com:8443/group/subgroup/go-repo-template/-/commit/" + sha,
+			file:    "https://gitlab.example.com:8443/group/subgroup/go-repo-template/-/blob/" + sha + "/.golangci.yml",
+		},
+		"codeberg": {
+			repoURL: "ssh://git@codeberg.org:2222/nieomylnieja/go-repo-template.git",
+			web:     "https://codeberg.org/nieomylnieja/go-repo-template",
+			commit:  "https://codeberg.org/nieomylnieja/go-repo-template/commit/" + sha,
+			file:    "https://codeberg.org/nieomylnieja/go-repo-template/src/commit/" + sha + "/.golangci.yml",
+		},
+		"local": {
+			repoURL: "/home/nieomylnieja/go-repo-template",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if web := webURL(test.repoURL); web != test.web {
+				t.Errorf("expected web URL %q, got %q", test.web, web)
+			}
+			if commit := commitURL(test.repoURL, sha); commit != test.commit {
+				t.Errorf("expected commit URL %q, got %q", test.commit, commit)
+			}
+			if file := fileURL(test.repoURL, sha, "/.golangci.yml"); file != test.file {
+				t.Errorf("expected file URL %q, got %q", test.file, file)
+			}
+		})
+	}
+}
+
+func TestPushToBranch(t *testing.T) {
+	dir := t.TempDir()
+	originPath := initTestOrigin(t, dir)
+	// Pushing to the checked out branch of a non-bare repository is not allowed.
+	mirrorPath := filepath.Join(dir, "mirror.git")
+	if _, err := execCmd("git", "clone", "--quiet", "--bare", originPath, mirrorPath); err != nil {
+		t.Fatal(err)
+	}
+	repo := readTestConfig(t, dir, mirrorPath, "").Root
+	if err := cloneRepo(repo); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateTrackedRef(repo, nil); err != nil {
+		t.Fatal(err)
+	}
+	details := &changeDetails{Branch: "gitsync-update", CommitTitle: "chore: gitsync update"}
+	commitFile := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repo.GetPath(), "file"), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := commitChanges(repo, details); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	commitFile("v1")
+	for _, expectPushed := range []bool{true, false} {
+		pushed, err := pushToBranch(repo, "origin", "main")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pushed != expectPushed {
+			t.Errorf("expected pushed to be %t, got %t", expectPushed, pushed)
+		}
+	}
+	out, err := execCmd("git", "-C", mirrorPath, "show", "main:file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "v1" {
+		t.Errorf("expected remote file content to be v1, got %s", out)
+	}
+	if _, err = execCmd("git", "-C", mirrorPath, "rev-parse", "--verify", "refs/heads/gitsync-update"); err == nil {
+		t.Error("expected the sync branch not to be pushed")
+	}
+	// Diverged branch must not be force pushed.
+	if _, err = execCmd("git", "-C", repo.GetPath(), "reset", "--hard", "--quiet", "HEAD^"); err != nil {
+		t.Fatal(err)
+	}
+	commitFile("v2")
+	if _, err = pushToBranch(repo, "origin", "main"); err == nil {
+		t.Error("expected diverged branch push to fail")
+	}
+}
+
+func TestPushChanges_Fork(t *testing.T) {
+	dir := t.TempDir()
+	originPath := initTestOrigin(t, dir)
+	forkPath := filepath.Join(dir, "fork")
+	if _, err := execCmd("git", "clone", "--quiet", "--bare", originPath, forkPath); err != nil {
+		t.Fatal(err)
+	}
+	conf := readTestConfig(t, dir, originPath, "")
+	repo := conf.Repositories[0]
+	repo.Fork = &config.ForkOptions{Owner: "my-org"}
+	// The synchronized repository is cloned from the local origin, but pretends to be hosted on GitHub.
+	repo.URL = "https://github.com/nieomylnieja/go-libyear.git"
+	if _, err := execCmd("git", "clone", "--quiet", originPath, repo.GetPath()); err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeForge{forkURL: forkPath}
+	if err := setupFork(f, repo); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(f.forked, []string{"my-org/go-libyear"}) {
+		t.Errorf("expected my-org/go-libyear fork to be created, got %v", f.forked)
+	}
+	details := &changeDetails{Branch: "gitsync-update", CommitTitle: "chore: gitsync update"}
+	if err := os.WriteFile(filepath.Join(repo.GetPath(), "file"), []byte("v1"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := commitChanges(repo, details); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pushChanges(repo, forkRemote, details); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := execCmd("git", "-C", forkPath, "rev-parse", "--verify", "refs/heads/gitsync-update"); err != nil {
+		t.Errorf("expected the sync branch to be pushed to the fork: %v", err)
+	}
+	if _, err := execCmd("git", "-C", originPath, "rev-parse", "--verify", "refs/heads/gitsync-update"); err == nil {
+		t.Error("expected the sync branch not to be pushed to the origin")
+	}
+}
+
+func TestSetupFork_WaitsForFork(t *testing.T) {
+	dir := t.TempDir()
+	originPath := initTestOrigin(t, dir)
+	conf := readTestConfig(t, dir, originPath, "")
+	repo := conf.Repositories[0]
+	repo.Fork = &config.ForkOptions{Owner: "my-org"}
+	repo.URL = "https://github.com/nieomylnieja/go-libyear.git"
+	if _, err := execCmd("git", "clone", "--quiet", originPath, repo.GetPath()); err != nil {
+		t.Fatal(err)
+	}
+	originalAttempts, originalInterval := forkReadyAttempts, forkReadyInterval
+	t.Cleanup(func() { forkReadyAttempts, forkReadyInterval = originalAttempts, originalInterval })
+	forkReadyInterval = 10 * time.Millisecond
+
+	t.Run("not available", func(t *testing.T) {
+		forkReadyAttempts = 2
+		f := &fakeForge{forkURL: filepath.Join(dir, "missing-fork")}
+		if err := setupFork(f, repo); err == nil || !strings.Contains(err.Error(), "not available after 2 attempts") {
+			t.Errorf("expected fork not to be available, got: %v", err)
+		}
+	})
+	t.Run("created asynchronously", func(t *testing.T) {
+		forkReadyAttempts = 500
+		forkPath := filepath.Join(dir, "fork")
+		created := make(chan error, 1)
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			// The fork appears at once, not while it's being cloned.
+			tmpPath := filepath.Join(dir, "fork-tmp")
+			if _, err := execCmd("git", "clone", "--quiet", "--bare", originPath, tmpPath); err != nil {
+				created <- err
+				return
+			}
+			created <- os.Rename(tmpPath, forkPath)
+		}()
+		f := &fakeForge{forkURL: forkPath}
+		if err := setupFork(f, repo); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-created; err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestCommitChanges_Options(t *testing.T) {
+	dir := t.TempDir()
+	originPath := initTestOrigin(t, dir)
+	keyPath := filepath.Join(dir, "signing-key")
+	if _, err := execCmd("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-f", keyPath); err != nil {
+		t.Skipf("failed to generate SSH signing key: %v", err)
+	}
+	conf := readTestConfig(t, dir, originPath, fmt.Sprintf(`commit:
+  author:
+    name: gitsync-bot
+    email: bot@example.com
+  signing:
+    format: ssh
+    key: %s
+  trailers:
+    - "Co-authored-by: Mona <mona@example.com>"
+`, keyPath))
+	repo := conf.Root
+	if err := cloneRepo(repo); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateTrackedRef(repo, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo.GetPath(), "file"), []byte("v1"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	details := &changeDetails{Branch: "gitsync-update", CommitTitle: "chore: gitsync update", CommitBody: "Body."}
+	if err := commitChanges(repo, details); err != nil {
+		t.Fatal(err)
+	}
+	out, err := execCmd("git", "-C", repo.GetPath(), "log", "-1", "--format=%an <%ae>%n%cn <%ce>%n%B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "gitsync-bot <bot@example.com>\ngitsync-bot <bot@example.com>\nchore: gitsync update\n\n" +
+		"Body.\n\nCo-authored-by: Mona <mona@example.com>\n"
+	if actual := strings.TrimSpace(out.String()) + "\n"; actual != expected {
+		t.Errorf("expected commit:\n%s\ngot:\n%s", expected, actual)
+	}
+	out, err = execCmd("git", "-C", repo.GetPath(), "cat-file", "commit", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "-----BEGIN SSH SIGNATURE-----") {
+		t.Errorf("expected the commit to be signed with SSH key, got:\n%s", out)
+	}
+}
+
+func TestRunHooks(t *testing.T) {
+	dir := t.TempDir()
+	originPath := initTestOrigin(t, dir)
+	conf := readTestConfig(t, dir, originPath, "")
+	repo := conf.Root
+	if err := cloneRepo(repo); err != nil {
+		t.Fatal(err)
+	}
+	conf.SyncFiles[0].Hooks = []string{"echo file >> hooks.log"}
+	repo.Hooks = []string{"echo repo >> hooks.log"}
+	logPath := filepath.Join(repo.GetPath(), "hooks.log")
+
+	if err := runHooks(conf, repo, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := runHooks(conf, repo, []syncedFile{{Name: conf.SyncFiles[0].Name}}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "repo\nfile\nrepo\n"; string(data) != expected {
+		t.Errorf("expected hooks log %q, got %q", expected, string(data))
+	}
+	changed, err := hasChanges(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Error("expected the file created by the hooks to be reported as a change")
+	}
+
+	repo.Hooks = []string{"echo 'go.mod is broken'; exit 3", "echo unreachable >> hooks.log"}
+	err = runHooks(conf, repo, nil)
+	if err == nil || !strings.Contains(err.Error(), "go.mod is broken") {
+		t.Errorf("expected the failed hook output to be reported, got: %v", err)
+	}
+	if data, _ = os.ReadFile(logPath); strings.Contains(string(data), "unreachable") {
+		t.Error("expected the hooks following the failed one not to be run")
+	}
+}
+
+func TestResetCheckout(t *testing.T) {
+	dir := t.TempDir()
+	originPath := initTestOrigin(t, dir)
+	repo := readTestConfig(t, dir, originPath, "").Root
+	if err := cloneRepo(repo); err != nil {
+		t.Fatal(err)
+	}
+	for name, reset := range map[string]func(repo *config.Repository) error{
+		"reset checkout": resetCheckout,
+		// Leftovers of failed hooks must not survive into the next sync.
+		"update tracked ref": func(repo *config.Repository) error { return updateTrackedRef(repo, nil) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := updateTrackedRef(repo, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(repo.GetPath(), "file"), []byte("patched"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.MkdirAll(filepath.Join(repo.GetPath(), "vendor"), 0o750); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(repo.GetPath(), "vendor", "modules.txt"), nil, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if err := reset(repo); err != nil {
+				t.Fatal(err)
+			}
+			changed, err := hasChanges(repo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changed {
+				t.Error("expected the checkout to have no changes after reset")
+			}
+		})
+	}
+}
+
+func TestUpdateTrackedRef_SingleBranch(t *testing.T) {
+	dir := t.TempDir()
+	originPath := initTestOrigin(t, dir)
+	commit := func(message string) string {
+		t.Helper()
+		if _, err := execCmd("git", "-C", originPath, "commit", "--quiet", "--allow-empty", "-m", message); err != nil {
+			t.Fatal(err)
+		}
+		out, err := execCmd("git", "-C", originPath, "rev-parse", "HEAD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(out.String())
+	}
+	tagged := commit("release")
+	if _, err := execCmd("git", "-C", originPath, "tag", "v1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	// The cases are run in order, reusing the checkout unless a fresh clone is requested.
+	tests := []struct {
+		name  string
+		ref   string
+		fresh bool
+		setup func() string
+	}{
+		{
+			name:  "tag",
+			ref:   "v1.0.0",
+			setup: func() string { return tagged },
+		},
+		{
+			name: "moved tag",
+			ref:  "v1.0.0",
+			setup: func() string {
+				sha := commit("fixed release")
+				if _, err := execCmd("git", "-C", originPath, "tag", "--force", "v1.0.0"); err != nil {
+					t.Fatal(err)
+				}
+				return sha
+			},
+		},
+		{
+			name:  "branch",
+			ref:   "origin/main",
+			setup: func() string { return commit("next") },
+		},
+		{
+			name:  "commit",
+			fresh: true,
+			setup: func() string { return tagged },
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			storeDir := dir
+			if test.fresh {
+				storeDir = t.TempDir()
+			}
+			conf := readTestConfig(t, storeDir, originPath, "clone:\n  singleBranch: true\n")
+			expected := test.setup()
+			conf.Root.Ref = test.ref
+			if conf.Root.Ref == "" {
+				conf.Root.Ref = expected
+			}
+			if err := cloneRepo(conf.Root); err != nil {
+				t.Fatal(err)
+			}
+			if err := updateTrackedRef(conf.Root, nil); err != nil {
+				t.Fatal(err)
+			}
+			sha, err := headCommit(conf.Root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sha != expected {
+				t.Errorf("expected %s commit to be checked out, got %s", expected, sha)
+			}
+		})
+	}
+	t.Run("missing ref", func(t *testing.T) {
+		conf := readTestConfig(t, dir, originPath, "clone:\n  singleBranch: true\n")
+		conf.Root.Ref = "v2.0.0"
+		if err := updateTrackedRef(conf.Root, nil); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func TestRequiresForge(t *testing.T) {
+	tests := map[string]struct {
+		extra    string
+		fork     bool
+		expected bool
+	}{
+		"pull requests by default": {
+			expected: true,
+		},
+		"push delivery": {
+			extra: "delivery: push\n",
+		},
+		"push delivery to fork": {
+			extra:    "delivery: push\n",
+			fork:     true,
+			expected: true,
+		},
+		"local delivery": {
+			extra: "delivery: local\n",
+		},
+		"local delivery with fork": {
+			extra: "delivery: local\n",
+			fork:  true,
+		},
+		"discovery": {
+			extra:    "delivery: local\ndiscover:\n  - owner: nieomylnieja\n",
+			expected: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			conf := readTestConfig(t, dir, filepath.Join(dir, "origin"), test.extra)
+			if test.fork {
+				conf.Repositories[0].Fork = &config.ForkOptions{}
+			}
+			if actual := requiresForge(conf, conf.Repositories); actual != test.expected {
+				t.Errorf("expected %t, got %t", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCloneRepo_RepairsStoredCheckout(t *testing.T) {
+	dir := t.TempDir()
+	originPath := initTestOrigin(t, dir)
+	conf := readTestConfig(t, dir, originPath, "")
+	repo := conf.Root
+	remoteURL := func() string {
+		out, err := execCmd("git", "-C", repo.GetPath(), "remote", "get-url", "origin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(out.String())
+	}
+	if err := cloneRepo(repo); err != nil {
+		t.Fatal(err)
+	}
+	if !isManagedCheckout(repo.GetPath()) {
+		t.Fatal("expected the checkout to be marked as created by gitsync")
+	}
+
+	t.Run("same repository under different URL", func(t *testing.T) {
+		if _, err := execCmd("git", "-C", repo.GetPath(), "remote", "set-url", "origin", originPath+".git"); err != nil {
+			t.Fatal(err)
+		}
+		if err := cloneRepo(repo); err != nil {
+			t.Fatal(err)
+		}
+		if url := remoteURL(); url != originPath {
+			t.Errorf("expected remote URL %s, got %s", originPath, url)
+		}
+	})
+	t.Run("different repository declined", func(t *testing.T) {
+		if _, err := execCmd("git", "-C", repo.GetPath(), "remote", "set-url", "origin", "/old/url"); err != nil {
+			t.Fatal(err)
+		}
+		setTestStdin(t, "n\n")
+		if err := cloneRepo(repo); err == nil {
+			t.Fatal("expected an error")
+		}
+		if url := remoteURL(); url != "/old/url" {
+			t.Errorf("expected remote URL to be left intact, got %s", url)
+		}
+	})
+	t.Run("different repository confirmed", func(t *testing.T) {
+		setTestStdin(t, "y\n")
+		if err := cloneRepo(repo); err != nil {
+			t.Fatal(err)
+		}
+		if url := remoteURL(); url != originPath {
+			t.Errorf("expected remote URL %s, got %s", originPath, url)
+		}
+	})
+	t.Run("invalid checkout", func(t *testing.T) {
+		if err := os.RemoveAll(filepath.Join(repo.GetPath(), ".git")); err != nil {
+			t.Fatal(err)
+		}
+		if problem := verifyCheckout(repo.GetPath()); problem == "" {
+			t.Fatal("expected the checkout to be invalid")
+		}
+		setTestStdin(t, "")
+		if err := cloneRepo(repo); err == nil {
+			t.Fatal("expected an error without confirmation")
+		}
+		setTestStdin(t, "y\n")
+		if err := cloneRepo(repo); err != nil {
+			t.Fatal(err)
+		}
+		if problem := verifyCheckout(repo.GetPath()); problem != "" {
+			t.Errorf("expected the checkout to be cloned again, got: %s", problem)
+		}
+	})
+}
+
+func TestPruneStore(t *testing.T) {
+	dir := t.TempDir()
+	originPath := initTestOrigin(t, dir)
+	conf := readTestConfig(t, dir, originPath, "")
+	storePath := conf.GetStorePath()
+	if err := cloneRepo(conf.Root); err != nil {
+		t.Fatal(err)
+	}
+	// Checkout of a repository which is no longer in the config.
+	if _, err := execCmd("git", "clone", "--quiet", originPath, filepath.Join(storePath, "stale")); err != nil {
+		t.Fatal(err)
+	}
+	if err := markManagedCheckout(filepath.Join(storePath, "stale")); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{conf.Repositories[0].Name, "unrelated"} {
+		if err := os.MkdirAll(filepath.Join(storePath, name), 0o750); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(storePath, "file"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{filepath.Join(storePath, "stale")}
+	assertRemoved := func(opts PruneOptions, stdin string, expectedRemoved []string, expectedEntries int) {
+		t.Helper()
+		setTestStdin(t, stdin)
+		removed, err := PruneStore(conf, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(removed, expectedRemoved) {
+			t.Errorf("expected %v to be removed, got %v", expectedRemoved, removed)
+		}
+		entries, err := os.ReadDir(storePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != expectedEntries {
+			t.Errorf("expected %d store entries to remain, got %d", expectedEntries, len(entries))
+		}
+	}
+
+	assertRemoved(PruneOptions{DryRun: true}, "", expected, 5)
+	assertRemoved(PruneOptions{}, "n\n", nil, 5)
+	assertRemoved(PruneOptions{}, "y\n", expected, 4)
+}
+
+func TestPushChanges(t *testing.T) {
+	dir := t.TempDir()
+	originPath := initTestOrigin(t, dir)
+	conf := readTestConfig(t, dir, originPath, "")
+	repo := conf.Root
+	details := &changeDetails{Branch: "gitsync-update", CommitTitle: "chore: gitsync update"}
+	// commitFile recreates the sync branch from the tracked ref with the file changed, same as sync does.
+	commitFile := func(content string) {
+		t.Helper()
+		if err := cloneRepo(repo); err != nil {
+			t.Fatal(err)
+		}
+		if err := updateTrackedRef(repo, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(repo.GetPath(), "file"), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := commitChanges(repo, details); err != nil {
+			t.Fatal(err)
+		}
+	}
+	push := func(expectPushed bool) {
+		t.Helper()
+		pushed, err := pushChanges(repo, "origin", details)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pushed != expectPushed {
+			t.Errorf("expected pushed to be %t, got %t", expectPushed, pushed)
+		}
+	}
+	remoteCommits := func() int {
+		t.Helper()
+		out, err := execCmd("git", "-C", originPath, "rev-list", "--count", "main..gitsync-update")
+		if err != nil {
+			t.Fatal(err)
+		}
+		count, _ := strconv.Atoi(strings.TrimSpace(out.String()))
+		return count
+	}
+
+	commitFile("v1")
+	push(true)
+	commitFile("v1")
+	push(false)
+	commitFile("v2")
+	push(true)
+	if count := remoteCommits(); count != 1 {
+		t.Errorf("expected force pushed branch to have 1 commit, got %d", count)
+	}
+	repo = readTestConfig(t, dir, originPath, "pushStrategy: append\n").Root
+	commitFile("v3")
+	push(true)
+	if count := remoteCommits(); count != 2 {
+		t.Errorf("expected appended branch to have 2 commits, got %d", count)
+	}
+	out, err := execCmd("git", "-C", originPath, "show", "gitsync-update:file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "v3" {
+		t.Errorf("expected remote file content to be v3, got %s", out)
+	}
+}
+
+// setTestStdin replaces [os.Stdin] with the input for the duration of the test.
+func setTestStdin(t *testing.T, input string) {
+	t.Helper()
+	stdin, err := os.CreateTemp(t.TempDir(), "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = stdin.Close() })
+	if _, err = stdin.WriteString(input); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stdin.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	originalStdin := os.Stdin
+	os.Stdin = stdin
+	t.Cleanup(func() { os.Stdin = originalStdin })
+}
+
+// initTestOrigin creates a repository with a single commit on the main branch in dir.
+// It also sets the git identity used by the tests.
+func initTestOrigin(t *testing.T, dir string) string {
+	t.Helper()
+	for _, name := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(name, "gitsync")
+	}
+	for _, name := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(name, "gitsync@example.com")
+	}
+	originPath := filepath.Join(dir, "origin")
+	for _, args := range [][]string{
+		{"init", "--quiet", "--initial-branch", "main", originPath},
+		{"-C", originPath, "commit", "--quiet", "--allow-empty", "-m", "initial commit"},
+	} {
+		if _, err := execCmd("git", args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return originPath
+}
+
+// readTestConfig writes and reads a minimal config with the repositories store located in dir.
+// The extra YAML is appended to the config.
+func readTestConfig(t *testing.T, dir, rootURL, extra string) *config.Config {
+	t.Helper()
+	path := filepath.Join(dir, "config.yaml")
+	data := fmt.Sprintf(`storePath: %s
+root:
+  name: template
+  url: %s
+syncRepositories:
+  - name: go-libyear
+    url: https://github.com/nieomylnieja/go-libyear.git
+syncFiles:
+  - name: golangci linter config
+    path: .golangci.yml
+%s`, filepath.Join(dir, "store"), rootURL, extra)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	conf, err := config.ReadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conf
+}
+
+func TestRenderChangeDetails(t *testing.T) {
+	root := &config.Repository{Name: "template", URL: "git@github.com:nieomylnieja/go-repo-template.git"}
+	repo := &config.Repository{
+		Name: "go-libyear",
+		URL:  "https://github.com/nieomylnieja/go-libyear.git",
+		Templates: &config.Templates{
+			Branch:      "chore/gitsync-{{ .Root.Name }}",
+			CommitTitle: "chore: sync {{ .Hunks }} change(s) from {{ .Root.Name }}@{{ .ShortRootSHA }}",
+		},
+	}
+	if _, err := config.New(filepath.Join(t.TempDir(), "config.json"), root, []*config.Repository{repo}); err != nil {
+		t.Fatal(err)
+	}
+	const (
+		rootSHA     = "4f2c1a9e0b7d3c5a6f8e9d0c1b2a3f4e5d6c7b8a"
+		rootURL     = "https://github.com/nieomylnieja/go-repo-template"
+		previousSHA = "0a1b2c3d4e5f60718293a4b5c6d7e8f901234567"
+	)
+	files := []syncedFile{
+		{Name: "golangci linter config", Path: ".golangci.yml", Hunks: 2},
+		{Name: "goreleaser config", Path: ".goreleaser.yml", Hunks: 1},
+	}
+	commits := []rootCommit{{
+		SHA:      rootSHA,
+		ShortSHA: shortSHA(rootSHA),
+		Subject:  "Enable gocritic",
+		URL:      commitURL(root.URL, rootSHA),
+	}}
+	details, err := renderChangeDetails(newChangeSummary(root, repo, rootSHA, previousSHA, commits, files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := changeDetails{
+		Branch:      "chore/gitsync-template",
+		CommitTitle: "chore: sync 3 change(s) from template@4f2c1a9",
+		CommitBody: `Synced the following files:
+
+- .golangci.yml (` + rootURL + `/blob/` + rootSHA + `/.golangci.yml)
+- .goreleaser.yml (` + rootURL + `/blob/` + rootSHA + `/.goreleaser.yml)
+
+Root repository: ` + rootURL + `
+Root ref: origin/main
+Root commit: ` + rootSHA + `
+
+Root commits since the previous sync:
+
+- 4f2c1a9 Enable gocritic
+`,
+		PullRequestTitle: "chore: sync 3 change(s) from template@4f2c1a9",
+		PullRequestBody: `Synced the following files:
+
+- [` + "`.golangci.yml`" + `](` + rootURL + `/blob/` + rootSHA + `/.golangci.yml)
+- [` + "`.goreleaser.yml`" + `](` + rootURL + `/blob/` + rootSHA + `/.goreleaser.yml)
+
+Root repository: ` + rootURL + `
+Root ref: ` + "`origin/main`" + `
+Root commit: [4f2c1a9](` + rootURL + `/commit/` + rootSHA + `)
+
+Root commits since the previous sync:
+
+- [4f2c1a9](` + rootURL + `/commit/` + rootSHA + `) Enable gocritic
+
+Pull request generated by [gitsync](` + gitsyncURL + `)`,
+	}
+	if *details != expected {
+		t.Errorf("expected:\n%+v\ngot:\n%+v", expected, *details)
+	}
+
+	repo.Templates.Branch = "invalid..{{ .Repository.Name }}"
+	if _, err = config.New(filepath.Join(t.TempDir(), "config.json"), root, []*config.Repository{repo}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = renderChangeDetails(newChangeSummary(root, repo, rootSHA, "", nil, files)); err == nil {
+		t.Error("expected an error for invalid branch name")
+	}
+}
+
+func TestUpstream(t *testing.T) {
+	tests := map[string]struct {
+		extra             string
+		expectedCommitted bool
+	}{
+		"accepted hunk": {
+			expectedCommitted: true,
+		},
+		"ignored hunk": {
+			// Ignore rules are defined for the root to synchronized repository direction.
+			extra: `ignore:
+  - repositoryName: go-libyear
+    hunks:
+      - changes: ["-    - errcheck"]
+`,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			rootPath := initTestOrigin(t, dir)
+			repoPath := filepath.Join(dir, "go-libyear")
+			for path, content := range map[string]string{
+				rootPath: "linters:\n  enable:\n    - govet\n",
+				repoPath: "linters:\n  enable:\n    - govet\n    - errcheck\n",
+			} {
+				if _, err := execCmd("git", "init", "--quiet", "--initial-branch", "main", path); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(path, ".golangci.yml"), []byte(content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := execCmd("git", "-C", path, "add", "--all"); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := execCmd("git", "-C", path, "commit", "--quiet", "-m", "add linter config"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			conf := readTestConfig(t, dir, rootPath, "delivery: local\n"+test.extra)
+			conf.Repositories[0].URL = repoPath
+			setTestStdin(t, "y\n")
+
+			if err := Upstream(conf, UpstreamOptions{From: "go-libyear"}); err != nil {
+				t.Fatal(err)
+			}
+			out, err := execCmd("git", "-C", conf.Root.GetPath(), "log", "-1", "--format=%s")
+			if err != nil {
+				t.Fatal(err)
+			}
+			committed := strings.TrimSpace(out.String()) == "chore: gitsync upstream changes from go-libyear"
+			if committed != test.expectedCommitted {
+				t.Fatalf("expected committed to be %t, got last commit: %s", test.expectedCommitted, out)
+			}
+			if !committed {
+				return
+			}
+			data, err := os.ReadFile(filepath.Join(conf.Root.GetPath(), ".golangci.yml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := "linters:\n  enable:\n    - govet\n    - errcheck\n"; string(data) != expected {
+				t.Errorf("expected root file content %q, got %q", expected, data)
+			}
+			out, err = execCmd("git", "-C", conf.Root.GetPath(), "branch", "--show-current")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if branch := strings.TrimSpace(out.String()); branch != "gitsync-upstream-go-libyear" {
+				t.Errorf("expected gitsync-upstream-go-libyear branch, got %s", branch)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package gitsync
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/nieomylnieja/gitsync/internal/config"
+)
+
+// runHooks runs the hooks of the updated files, followed by the repository's hooks,
+// in the synchronized repository's checkout.
+// It stops at the first failed hook and returns an error with its output.
+func runHooks(conf *config.Config, repo *config.Repository, files []syncedFile) error {
+	var hooks []string
+	for _, file := range conf.SyncFiles {
+		if slices.ContainsFunc(files, func(f syncedFile) bool { return f.Name == file.Name }) {
+			hooks = append(hooks, file.Hooks...)
+		}
+	}
+	hooks = append(hooks, repo.Hooks...)
+	for _, hook := range hooks {
+		fmt.Printf("%s: running hook: %s\n", repo.Name, hook)
+		if _, err := newCmd().
+			SetDir(repo.GetPath()).
+			CombineOutput().
+			Exec("sh", "-c", hook); err != nil {
+			return fmt.Errorf("hook '%s' failed: %w", hook, err)
+		}
+	}
+	return nil
+}
+
+// hasChanges reports whether the repository's checkout has any uncommitted changes.
+func hasChanges(repo *config.Repository) (bool, error) {
+	out, err := execCmd("git", "-C", repo.GetPath(), "status", "--porcelain")
+	if err != nil {
+		return false, fmt.Errorf("failed to get repository status: %w", err)
+	}
+	return out.Len() > 0, nil
+}
@@ -0,0 +1,184 @@
+package gitsync
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/nieomylnieja/gitsync/internal/config"
+	"github.com/nieomylnieja/gitsync/internal/giturl"
+)
+
+// minFileSimilarity is the minimal similarity of the root and synchronized files
+// for the file to be suggested by [Init].
+const minFileSimilarity = 0.5
+
+// InitOptions define the repositories [Init] scaffolds the config for.
+type InitOptions struct {
+	// ConfigPath is the path the config will be saved under.
+	ConfigPath string
+	RootURL    string
+	RepoURLs   []string
+}
+
+// Init scaffolds a [config.Config] for the root and synchronized repositories.
+// Repository names are derived from their URLs.
+// The repositories are cloned into the default store and every file tracked by the root repository,
+// which is also present under the same path and has similar content in at least one of
+// the synchronized repositories, is suggested as a file to keep in sync.
+func Init(opts InitOptions) (*config.Config, error) {
+	if _, err := execCmd("git", "--version"); err != nil {
+		return nil, errors.New("'git' is required to be installed")
+	}
+	if opts.RootURL == "" {
+		return nil, errors.New("root repository URL is required")
+	}
+	if len(opts.RepoURLs) == 0 {
+		return nil, errors.New("at least one synchronized repository URL is required")
+	}
+	urls := make([]*giturl.URL, 0, len(opts.RepoURLs)+1)
+	for _, rawURL := range append([]string{opts.RootURL}, opts.RepoURLs...) {
+		u, err := giturl.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, u)
+	}
+	names := uniqueRepositoryNames(urls)
+	root := &config.Repository{Name: names[0], URL: opts.RootURL}
+	repos := make([]*config.Repository, 0, len(opts.RepoURLs))
+	for i, repoURL := range opts.RepoURLs {
+		repos = append(repos, &config.Repository{Name: names[i+1], URL: repoURL})
+	}
+	conf, err := config.New(opts.ConfigPath, root, repos)
+	if err != nil {
+		return nil, err
+	}
+	// #nosec G304
+	if err = os.MkdirAll(conf.GetStorePath(), 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create repositories store under specified path: %w", err)
+	}
+	for _, repo := range append(repos, root) {
+		if err = cloneRepo(repo); err != nil {
+			return nil, fmt.Errorf("failed to clone repository %s: %w", repo.Name, err)
+		}
+		if err = updateTrackedRef(repo, nil); err != nil {
+			return nil, fmt.Errorf("failed to update repository %s: %w", repo.Name, err)
+		}
+	}
+	files, err := suggestSyncFiles(root, repos)
+	if err != nil {
+		return nil, err
+	}
+	conf.SyncFiles = files
+	if err = conf.Validate(); err != nil {
+		return nil, fmt.Errorf("scaffolded config is invalid: %w", err)
+	}
+	return conf, nil
+}
+
+// suggestSyncFiles returns every file tracked by the root repository which has a similar counterpart
+// in at least one of the synchronized repositories.
+// If only some of the repositories have the file, it is limited to them with [config.Selector].
+func suggestSyncFiles(root *config.Repository, repos []*config.Repository) ([]*config.File, error) {
+	out, err := execCmd("git", "-C", root.GetPath(), "ls-files")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list root repository files: %w", err)
+	}
+	var files []*config.File
+	for _, filePath := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if filePath == "" {
+			continue
+		}
+		rootData, err := readTextFile(filepath.Join(root.GetPath(), filePath))
+		if err != nil || rootData == nil {
+			continue
+		}
+		var matching []string
+		for _, repo := range repos {
+			data, err := readTextFile(filepath.Join(repo.GetPath(), filePath))
+			if err != nil || data == nil {
+				continue
+			}
+			if fileSimilarity(rootData, data) >= minFileSimilarity {
+				matching = append(matching, repo.Name)
+			}
+		}
+		if len(matching) == 0 {
+			continue
+		}
+		file := &config.File{Name: filePath, Path: filePath}
+		if len(matching) < len(repos) {
+			file.Repositories = matching
+		}
+		fmt.Printf("suggesting %s (%s)\n", filePath, strings.Join(matching, ", "))
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no common files found between the root and synchronized repositories")
+	}
+	return files, nil
+}
+
+// readTextFile reads the file, returning nil if it does not exist, is not a regular file, or is binary.
+func readTextFile(path string) ([]byte, error) {
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, nil
+	}
+	// #nosec G304
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.IndexByte(data, 0) != -1 {
+		return nil, nil
+	}
+	return data, nil
+}
+
+// fileSimilarity returns the ratio of lines shared by both files to the total number of lines,
+// ranging from 0 (no common lines) to 1 (same lines).
+func fileSimilarity(a, b []byte) float64 {
+	aLines := strings.Split(strings.TrimSuffix(string(a), "\n"), "\n")
+	bLines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	counts := make(map[string]int, len(aLines))
+	for _, line := range aLines {
+		counts[line]++
+	}
+	common := 0
+	for _, line := range bLines {
+		if counts[line] > 0 {
+			counts[line]--
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(aLines)+len(bLines))
+}
+
+// uniqueRepositoryNames derives repository names from their URLs.
+// If the names are not unique, they are prefixed with the repositories' owners.
+func uniqueRepositoryNames(urls []*giturl.URL) []string {
+	names := make([]string, 0, len(urls))
+	counts := make(map[string]int, len(urls))
+	for _, u := range urls {
+		counts[u.Name]++
+	}
+	used := make(map[string]int, len(urls))
+	for _, u := range urls {
+		name := u.Name
+		if owner := path.Base(u.Owner); counts[name] > 1 && u.Owner != "" && owner != "/" {
+			name = owner + "-" + name
+		}
+		used[name]++
+		if used[name] > 1 {
+			name = fmt.Sprintf("%s-%d", name, used[name])
+		}
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,134 @@
+package gitsync
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nieomylnieja/gitsync/internal/config"
+)
+
+// pushChanges pushes the committed sync branch to the remote, reporting whether it was pushed.
+// The remote is either 'origin' or the [forkRemote].
+// If the remote sync branch already has the same content, it is left untouched,
+// so that CI is not retriggered and reviews are not dismissed.
+// Otherwise, the branch is updated according to the repository's [config.PushStrategy].
+func pushChanges(repo *config.Repository, remote string, details *changeDetails) (bool, error) {
+	path := repo.GetPath()
+	branch := details.Branch
+	remoteSHA, err := fetchRemoteBranch(repo, remote, branch)
+	if err != nil {
+		return false, err
+	}
+	force := true
+	if remoteSHA != "" {
+		same, err := haveSameTree(path, "HEAD", remoteSHA)
+		if err != nil {
+			return false, err
+		}
+		if same {
+			fmt.Printf("%s: remote %s branch is up to date, skipping push\n", repo.Name, branch)
+			return false, nil
+		}
+		if repo.GetPushStrategy() == config.PushStrategyAppend {
+			if err = appendToRemoteBranch(repo, branch, remoteSHA); err != nil {
+				return false, err
+			}
+			force = false
+		}
+	}
+	fmt.Printf("%s: pushing changes to %s remote\n", repo.Name, remote)
+	args := []string{"-C", path, "push"}
+	if force {
+		args = append(args, "--force")
+	}
+	args = append(args, "-u", remote, branch)
+	if _, err = execCmd("git", args...); err != nil {
+		return false, fmt.Errorf("failed to push changes to remote: %w", err)
+	}
+	return true, nil
+}
+
+// pushToBranch pushes the committed changes to the remote branch other than the sync branch,
+// see [config.Repository.PushBranch], reporting whether it was pushed.
+// The branch is never force pushed, if it diverged from the tracked ref, the push fails.
+func pushToBranch(repo *config.Repository, remote, branch string) (bool, error) {
+	path := repo.GetPath()
+	remoteSHA, err := fetchRemoteBranch(repo, remote, branch)
+	if err != nil {
+		return false, err
+	}
+	if remoteSHA != "" {
+		same, err := haveSameTree(path, "HEAD", remoteSHA)
+		if err != nil {
+			return false, err
+		}
+		if same {
+			fmt.Printf("%s: remote %s branch is up to date, skipping push\n", repo.Name, branch)
+			return false, nil
+		}
+	}
+	fmt.Printf("%s: pushing changes to %s branch of %s remote\n", repo.Name, branch, remote)
+	if _, err = execCmd("git", "-C", path, "push", remote, "HEAD:refs/heads/"+branch); err != nil {
+		return false, fmt.Errorf("failed to push changes to remote %s branch, "+
+			"it might have diverged from the tracked ref: %w", branch, err)
+	}
+	return true, nil
+}
+
+// fetchRemoteBranch fetches the branch from the remote and returns its head commit SHA.
+// If the branch does not exist on the remote, an empty string is returned.
+func fetchRemoteBranch(repo *config.Repository, remote, branch string) (string, error) {
+	path := repo.GetPath()
+	out, err := execCmd("git", "-C", path, "ls-remote", "--heads", remote, "refs/heads/"+branch)
+	if err != nil {
+		return "", fmt.Errorf("failed to list remote %s branch: %w", branch, err)
+	}
+	sha, _, _ := strings.Cut(strings.TrimSpace(out.String()), "\t")
+	if sha == "" {
+		return "", nil
+	}
+	args := []string{"-C", path, "fetch", "--force"}
+	if repo.GetCloneOptions().Depth > 0 {
+		args = append(args, "--depth", "1")
+	}
+	args = append(args, remote, fmt.Sprintf("+refs/heads/%[2]s:refs/remotes/%[1]s/%[2]s", remote, branch))
+	if _, err = execCmd("git", args...); err != nil {
+		return "", fmt.Errorf("failed to fetch remote %s branch: %w", branch, err)
+	}
+	return sha, nil
+}
+
+// haveSameTree reports whether both commits point to the same tree, i.e. have the same content.
+func haveSameTree(path, a, b string) (bool, error) {
+	out, err := execCmd("git", "-C", path, "rev-parse", a+"^{tree}", b+"^{tree}")
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve commit trees: %w", err)
+	}
+	trees := strings.Fields(out.String())
+	return len(trees) == 2 && trees[0] == trees[1], nil
+}
+
+// appendToRemoteBranch replaces the sync branch commit, created on top of the tracked ref,
+// with a commit of the same content and message on top of the remote sync branch.
+// If the remote branch does not contain the tracked ref's commit, it is merged in as the second parent,
+// so that the pull request only shows the synchronized changes.
+func appendToRemoteBranch(repo *config.Repository, branch, remoteSHA string) error {
+	path := repo.GetPath()
+	fmt.Printf("%s: appending changes to remote %s branch\n", repo.Name, branch)
+	args := []string{"commit-tree", "HEAD^{tree}", "-p", remoteSHA}
+	if _, err := execCmd("git", "-C", path, "merge-base", "--is-ancestor", "HEAD^", remoteSHA); err != nil {
+		args = append(args, "-p", "HEAD^")
+	}
+	message, err := execCmd("git", "-C", path, "log", "-1", "--format=%B", "HEAD")
+	if err != nil {
+		return fmt.Errorf("failed to read commit message: %w", err)
+	}
+	out, err := gitCommit(repo, message, append(args, "-F", "-")...)
+	if err != nil {
+		return fmt.Errorf("failed to create commit on top of remote %s branch: %w", branch, err)
+	}
+	if _, err = execCmd("git", "-C", path, "reset", "--soft", strings.TrimSpace(out.String())); err != nil {
+		return fmt.Errorf("failed to move %s branch: %w", branch, err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package gitsync
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nieomylnieja/gitsync/internal/config"
+)
+
+// stateFileName is the name of the file in the repositories store which holds the [syncState].
+const stateFileName = "gitsync-state.json"
+
+// syncState is the outcome of the previous synchronizations, persisted between the runs.
+type syncState struct {
+	// Repositories maps synchronized repositories' names to their state.
+	Repositories map[string]repositoryState `json:"repositories"`
+
+	path string
+}
+
+type repositoryState struct {
+	// RootSHA is the root repository commit the changes were last delivered from,
+	// either pushed or, for [config.DeliveryLocal], committed.
+	RootSHA  string    `json:"rootSha"`
+	SyncedAt time.Time `json:"syncedAt"`
+	// PullRequest is the number of the pull request opened for the sync branch.
+	PullRequest int `json:"pullRequest,omitempty"`
+}
+
+// readSyncState reads the [syncState] from the repositories store.
+// If the state file does not exist yet, an empty state is returned.
+func readSyncState(conf *config.Config) (*syncState, error) {
+	state := &syncState{
+		Repositories: make(map[string]repositoryState),
+		path:         filepath.Join(conf.GetStorePath(), stateFileName),
+	}
+	// #nosec G304
+	data, err := os.ReadFile(state.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read sync state file: %w", err)
+	}
+	if err = json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to decode sync state file %s: %w", state.path, err)
+	}
+	if state.Repositories == nil {
+		state.Repositories = make(map[string]repositoryState)
+	}
+	return state, nil
+}
+
+// recordSync records the root repository commit the repository's changes were delivered from and saves the state.
+func (s *syncState) recordSync(repo *config.Repository, rootSHA string) error {
+	repoState := s.Repositories[repo.Name]
+	repoState.RootSHA, repoState.SyncedAt = rootSHA, time.Now().UTC()
+	s.Repositories[repo.Name] = repoState
+	return s.save()
+}
+
+// save writes the state into a temporary file first and then renames it,
+// so that the state file is never left half-written.
+func (s *syncState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode sync state: %w", err)
+	}
+	tmpPath := s.path + ".tmp"
+	if err = os.WriteFile(tmpPath, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write sync state file: %w", err)
+	}
+	if err = os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("failed to replace sync state file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package gitsync
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nieomylnieja/gitsync/internal/config"
+	"github.com/nieomylnieja/gitsync/internal/giturl"
+)
+
+// managedConfigKey is the git config key marking the store checkouts created by gitsync.
+const managedConfigKey = "gitsync.managed"
+
+// verifyCheckout checks if the existing store checkout can be reused.
+// It returns a description of the problem if the checkout is not a valid git repository
+// of its own, e.g. an unrelated directory or a half-finished clone.
+func verifyCheckout(path string) (problem string) {
+	out, err := execCmd("git", "-C", path, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "not a git repository"
+	}
+	if !isSamePath(strings.TrimSpace(out.String()), path) {
+		return "not a git repository root"
+	}
+	if _, err = execCmd("git", "-C", path, "rev-parse", "--verify", "--quiet", "HEAD^{commit}"); err != nil {
+		return "no commit checked out, the clone might have been interrupted"
+	}
+	return ""
+}
+
+// repairStoredRepo makes sure the existing store checkout of the repository can be reused.
+// If the checkout is broken or belongs to a different repository, the user is asked whether it should
+// be removed, in which case false is returned, signaling that the repository has to be cloned again.
+// If the 'origin' remote points to the same repository under a different URL,
+// e.g. after the protocol was changed in the config, it is updated.
+func repairStoredRepo(repo *config.Repository) (bool, error) {
+	path := repo.GetPath()
+	if problem := verifyCheckout(path); problem != "" {
+		fmt.Printf("%s: %s is not a valid repository checkout (%s)\n", repo.Name, path, problem)
+		return false, removeStoredRepo(repo)
+	}
+	out, err := newCmd().
+		SkipErroneousStatus(2).
+		Exec("git", "-C", path, "remote", "get-url", "origin")
+	if err != nil {
+		return false, fmt.Errorf("failed to get repository remote URL: %w", err)
+	}
+	switch remoteURL := strings.TrimSpace(out.String()); {
+	case remoteURL == repo.URL:
+	case remoteURL == "" && isManagedCheckout(path):
+		fmt.Printf("%s: adding missing origin remote %s\n", repo.Name, repo.URL)
+		_, err = execCmd("git", "-C", path, "remote", "add", "origin", repo.URL)
+	case isSameRepository(remoteURL, repo.URL):
+		fmt.Printf("%s: updating origin remote URL from %s to %s\n", repo.Name, remoteURL, repo.URL)
+		_, err = execCmd("git", "-C", path, "remote", "set-url", "origin", repo.URL)
+	default:
+		fmt.Printf("%s: %s is a checkout of a different repository (origin: %s)\n", repo.Name, path, remoteURL)
+		return false, removeStoredRepo(repo)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to update repository remote URL: %w", err)
+	}
+	// Checkouts created before they were marked are marked once verified.
+	if err = markManagedCheckout(path); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// removeStoredRepo removes the repository's store checkout if the user confirms it.
+func removeStoredRepo(repo *config.Repository) error {
+	path := repo.GetPath()
+	if !confirm(fmt.Sprintf("%s: remove %s and clone the repository again?", repo.Name, path)) {
+		return fmt.Errorf("repository checkout %s cannot be reused, remove it or change 'storePath'", path)
+	}
+	fmt.Printf("%s: removing %s\n", repo.Name, path)
+	if err := os.RemoveAll(path); err != nil {
+		return fmt.Errorf("failed to remove repository checkout: %w", err)
+	}
+	return nil
+}
+
+// isSameRepository reports whether both URLs point to the same repository,
+// regardless of the protocol, e.g. 'git@github.com:nieomylnieja/gitsync.git'
+// and 'https://github.com/nieomylnieja/gitsync'.
+func isSameRepository(a, b string) bool {
+	urlA, err := giturl.Parse(a)
+	if err != nil {
+		return false
+	}
+	urlB, err := giturl.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(urlA.String(), urlB.String())
+}
+
+// markManagedCheckout marks the checkout as created by gitsync, see [isManagedCheckout].
+func markManagedCheckout(path string) error {
+	if _, err := execCmd("git", "-C", path, "config", "--local", managedConfigKey, "true"); err != nil {
+		return fmt.Errorf("failed to mark repository checkout as managed by gitsync: %w", err)
+	}
+	return nil
+}
+
+// isManagedCheckout reports whether the directory is a git checkout created by gitsync.
+func isManagedCheckout(path string) bool {
+	if verifyCheckout(path) != "" {
+		return false
+	}
+	out, err := execCmd("git", "-C", path, "config", "--local", "--get", managedConfigKey)
+	return err == nil && strings.TrimSpace(out.String()) == "true"
+}
+
+// PruneOptions alter the behavior of [PruneStore].
+type PruneOptions struct {
+	// DryRun, if true, only lists the stale repository checkouts.
+	DryRun bool
+	// Force, if true, removes the stale repository checkouts without asking for confirmation.
+	Force bool
+}
+
+// PruneStore removes the checkouts from the repositories store which do not belong
+// to any of the [config.Config] repositories, including the discovered ones.
+// Only the checkouts created by gitsync are removed, other directories are left intact.
+// It returns the paths of the removed checkouts, or of those which would be removed with dry run.
+func PruneStore(conf *config.Config, opts PruneOptions) ([]string, error) {
+	entries, err := os.ReadDir(conf.GetStorePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read repositories store: %w", err)
+	}
+	known := make(map[string]bool, len(conf.Repositories)+1)
+	for _, repo := range append(conf.Repositories, conf.Root) {
+		known[repo.Name] = true
+	}
+	var stale []string
+	for _, entry := range entries {
+		if !entry.IsDir() || known[entry.Name()] {
+			continue
+		}
+		path := filepath.Join(conf.GetStorePath(), entry.Name())
+		if !isManagedCheckout(path) {
+			fmt.Printf("%s: skipping %s, not a repository checkout created by gitsync\n", entry.Name(), path)
+			continue
+		}
+		fmt.Printf("%s: stale repository checkout %s\n", entry.Name(), path)
+		stale = append(stale, path)
+	}
+	if len(stale) == 0 || opts.DryRun {
+		return stale, nil
+	}
+	if !opts.Force && !confirm(fmt.Sprintf("Remove %d stale repository checkout(s)?", len(stale))) {
+		return nil, nil
+	}
+	var removed []string
+	for _, path := range stale {
+		fmt.Printf("Removing %s\n", path)
+		if err = os.RemoveAll(path); err != nil {
+			return removed, fmt.Errorf("failed to remove %s directory: %w", path, err)
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
+
+// confirm asks the user the yes or no question and reports whether it was confirmed.
+// If the input is closed, e.g. when not running interactively, the question is not confirmed.
+func confirm(question string) bool {
+	fmt.Printf("%s [y|n]: ", question)
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		switch strings.TrimSpace(scanner.Text()) {
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		default:
+			fmt.Print("Invalid input. Please enter y (yes) or n (no): ")
+		}
+	}
+	fmt.Println()
+	return false
+}
+
+// isSamePath reports whether both paths point to the same location, resolving any symbolic links.
+func isSamePath(a, b string) bool {
+	resolve := func(path string) string {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			path = resolved
+		}
+		return filepath.Clean(path)
+	}
+	return resolve(a) == resolve(b)
+}
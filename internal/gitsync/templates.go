@@ -0,0 +1,200 @@
+package gitsync
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/nieomylnieja/gitsync/internal/config"
+)
+
+// Default templates used when [config.Templates] are not defined.
+const (
+	defaultBranchTemplate      = "gitsync-update"
+	defaultCommitTitleTemplate = "chore: gitsync update"
+	defaultCommitBodyTemplate  = `Synced the following files:
+
+{{ range .Files }}- {{ .Path }}{{ if .URL }} ({{ .URL }}){{ end }}
+{{ end }}
+Root repository: {{ .RootURL }}
+Root ref: {{ .RootRef }}
+Root commit: {{ .RootSHA }}
+{{- if .RootCommits }}
+
+Root commits since the previous sync:
+{{ range .RootCommits }}
+- {{ .ShortSHA }} {{ .Subject }}
+{{- end }}
+{{- end }}
+`
+	defaultPullRequestTitleTemplate = "{{ .CommitTitle }}"
+	defaultPullRequestBodyTemplate  = `Synced the following files:
+
+{{ range .Files }}- {{ if .URL }}[` + "`" + `{{ .Path }}` + "`" + `]({{ .URL }})
+  {{- else }}` + "`" + `{{ .Path }}` + "`" + `{{ end }}
+{{ end }}
+Root repository: {{ .RootURL }}
+Root ref: ` + "`" + `{{ .RootRef }}` + "`" + `
+Root commit: {{ if .RootCommitURL }}[{{ .ShortRootSHA }}]({{ .RootCommitURL }})
+  {{- else }}` + "`" + `{{ .RootSHA }}` + "`" + `{{ end }}
+{{- if .RootCommits }}
+
+Root commits since the previous sync:
+{{ range .RootCommits }}
+- {{ if .URL }}[{{ .ShortSHA }}]({{ .URL }}){{ else }}` + "`" + `{{ .ShortSHA }}` + "`" + `{{ end }} {{ .Subject }}
+{{- end }}
+{{- end }}
+
+Pull request generated by [gitsync](` + gitsyncURL + `)`
+)
+
+// shortSHALength is the length of the abbreviated commit SHA.
+const shortSHALength = 7
+
+// syncedFile is a file which was updated in the synchronized repository.
+type syncedFile struct {
+	Name string
+	Path string
+	// Hunks is the number of applied hunks.
+	Hunks int
+	// URL is the permalink to the root file at the synchronized commit, empty for local repositories.
+	URL string
+}
+
+// rootCommit is a root repository commit which changed at least one of the synchronized files.
+type rootCommit struct {
+	SHA      string
+	ShortSHA string
+	Subject  string
+	// URL is the link to the commit, empty for local repositories.
+	URL string
+}
+
+// changeSummary is the data the [config.Templates] are executed with.
+type changeSummary struct {
+	Repository *config.Repository
+	Root       *config.Repository
+	// RootURL is the root repository web page URL, or its URL without the '.git' suffix for local repositories.
+	RootURL string
+	// RootRef is the tracked ref of the root repository, e.g. 'origin/main'.
+	RootRef string
+	// RootSHA is the root repository commit the files were synchronized from.
+	RootSHA      string
+	ShortRootSHA string
+	// RootCommitURL is the link to the RootSHA commit, empty for local repositories.
+	RootCommitURL string
+	// PreviousRootSHA is the root repository commit the changes were previously synchronized from,
+	// empty if the repository was not synchronized before.
+	PreviousRootSHA string
+	// RootCommits are the root repository commits since PreviousRootSHA
+	// which changed the synchronized files, newest first.
+	RootCommits []rootCommit
+	Files       []syncedFile
+	// Hunks is the total number of applied hunks.
+	Hunks int
+	// CommitTitle and CommitBody are only available to the pull request templates.
+	CommitTitle string
+	CommitBody  string
+}
+
+// changeDetails are the rendered [config.Templates].
+type changeDetails struct {
+	Branch           string
+	CommitTitle      string
+	CommitBody       string
+	PullRequestTitle string
+	PullRequestBody  string
+}
+
+func newChangeSummary(
+	root, repo *config.Repository,
+	rootSHA, previousRootSHA string,
+	rootCommits []rootCommit,
+	files []syncedFile,
+) changeSummary {
+	summary := changeSummary{
+		Repository:      repo,
+		Root:            root,
+		RootURL:         webURL(root.URL),
+		RootRef:         root.GetRef(),
+		RootSHA:         rootSHA,
+		ShortRootSHA:    shortSHA(rootSHA),
+		RootCommitURL:   commitURL(root.URL, rootSHA),
+		PreviousRootSHA: previousRootSHA,
+		RootCommits:     rootCommits,
+		Files:           make([]syncedFile, 0, len(files)),
+	}
+	if summary.RootURL == "" {
+		summary.RootURL = strings.TrimSuffix(root.URL, ".git")
+	}
+	for _, file := range files {
+		file.URL = fileURL(root.URL, rootSHA, file.Path)
+		summary.Files = append(summary.Files, file)
+		summary.Hunks += file.Hunks
+	}
+	return summary
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > shortSHALength {
+		return sha[:shortSHALength]
+	}
+	return sha
+}
+
+// renderChangeDetails executes the repository's [config.Templates], falling back to the default ones.
+func renderChangeDetails(summary changeSummary) (*changeDetails, error) {
+	templates := summary.Repository.GetTemplates()
+	var details changeDetails
+	for _, tpl := range []struct {
+		name, text, fallback string
+		result               *string
+	}{
+		{"branch", templates.Branch, defaultBranchTemplate, &details.Branch},
+		{"commitTitle", templates.CommitTitle, defaultCommitTitleTemplate, &details.CommitTitle},
+		{"commitBody", templates.CommitBody, defaultCommitBodyTemplate, &details.CommitBody},
+		{"pullRequestTitle", templates.PullRequestTitle, defaultPullRequestTitleTemplate, &details.PullRequestTitle},
+		{"pullRequestBody", templates.PullRequestBody, defaultPullRequestBodyTemplate, &details.PullRequestBody},
+	} {
+		text := tpl.text
+		if text == "" {
+			text = tpl.fallback
+		}
+		result, err := executeTemplate(tpl.name, text, summary)
+		if err != nil {
+			return nil, err
+		}
+		*tpl.result = result
+		// Pull request templates can reference the rendered commit message.
+		summary.CommitTitle, summary.CommitBody = details.CommitTitle, details.CommitBody
+	}
+	details.Branch = strings.TrimSpace(details.Branch)
+	details.CommitTitle = strings.TrimSpace(details.CommitTitle)
+	details.PullRequestTitle = strings.TrimSpace(details.PullRequestTitle)
+	if details.CommitTitle == "" {
+		return nil, fmt.Errorf("commit title rendered for %s repository is empty", summary.Repository.Name)
+	}
+	if details.PullRequestTitle == "" {
+		return nil, fmt.Errorf("pull request title rendered for %s repository is empty", summary.Repository.Name)
+	}
+	if _, err := execCmd("git", "check-ref-format", "--branch", details.Branch); err != nil {
+		return nil, fmt.Errorf("invalid branch name %q rendered for %s repository", details.Branch,
+			summary.Repository.Name)
+	}
+	return &details, nil
+}
+
+func executeTemplate(name, text string, data any) (string, error) {
+	tpl, err := template.New(name).
+		Option("missingkey=error").
+		Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s template: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err = tpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to execute %s template: %w", name, err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,252 @@
+package gitsync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/nieomylnieja/gitsync/internal/config"
+)
+
+// Templates used to describe the changes proposed to the root repository by [Upstream].
+const (
+	upstreamBranchTemplate      = "gitsync-upstream-{{ .Repository.Name }}"
+	upstreamCommitTitleTemplate = "chore: gitsync upstream changes from {{ .Repository.Name }}"
+	upstreamCommitBodyTemplate  = `Synced the following files from {{ .Repository.Name }} repository:
+
+{{ range .Files }}- {{ .Path }}{{ if .URL }} ({{ .URL }}){{ end }}
+{{ end }}
+Repository: {{ .RepositoryURL }}
+Commit: {{ .SHA }}
+`
+	upstreamPullRequestBodyTemplate = `Synced the following files from {{ .Repository.Name }} repository:
+
+{{ range .Files }}- {{ if .URL }}[` + "`" + `{{ .Path }}` + "`" + `]({{ .URL }})
+  {{- else }}` + "`" + `{{ .Path }}` + "`" + `{{ end }}
+{{ end }}
+Repository: {{ .RepositoryURL }}
+Commit: {{ if .CommitURL }}[{{ .ShortSHA }}]({{ .CommitURL }})
+  {{- else }}` + "`" + `{{ .SHA }}` + "`" + `{{ end }}
+
+Pull request generated by [gitsync](` + gitsyncURL + `)`
+)
+
+// UpstreamOptions alter the behavior of [Upstream].
+type UpstreamOptions struct {
+	// From is the name of the synchronized repository the changes are proposed from.
+	From string
+	// Files, if provided, limit the synchronized files to those with the given names.
+	Files []string
+	// DryRun, if true, applies the accepted changes in the root checkout and prints the commit message
+	// and pull request which would be created, without committing, pushing and opening pull requests.
+	// The checkout is reset afterward.
+	DryRun bool
+}
+
+// upstreamSummary is the data the upstream templates are executed with.
+type upstreamSummary struct {
+	Repository *config.Repository
+	Root       *config.Repository
+	// RepositoryURL is the repository web page URL, or its URL without the '.git' suffix for local repositories.
+	RepositoryURL string
+	// SHA is the repository commit the files were synchronized from.
+	SHA      string
+	ShortSHA string
+	// CommitURL is the link to the SHA commit, empty for local repositories.
+	CommitURL string
+	Files     []syncedFile
+}
+
+// Upstream is the reverse of [Run] with [CommandSync], it proposes the changes made to the synchronized
+// repository files back to the root repository.
+// The accepted hunks are applied to the root checkout, committed and delivered
+// according to the root repository's [config.Delivery].
+func Upstream(conf *config.Config, opts UpstreamOptions) error {
+	if err := checkDependencies(conf, []*config.Repository{conf.Root}, opts.DryRun); err != nil {
+		return err
+	}
+	if err := DiscoverRepositories(conf); err != nil {
+		return err
+	}
+	idx := slices.IndexFunc(conf.Repositories, func(r *config.Repository) bool { return r.Name == opts.From })
+	if idx == -1 {
+		return fmt.Errorf("repository '%s' is not defined in the config", opts.From)
+	}
+	repo := conf.Repositories[idx]
+	files, err := selectUpstreamFiles(conf, repo, opts.Files)
+	if err != nil {
+		return err
+	}
+	// #nosec G304
+	if err = os.MkdirAll(conf.GetStorePath(), 0o750); err != nil {
+		return fmt.Errorf("failed to create repositories store under specified path: %w", err)
+	}
+	for _, r := range []*config.Repository{repo, conf.Root} {
+		if err = cloneRepo(r); err != nil {
+			return fmt.Errorf("failed to clone repository %s: %w", r.Name, err)
+		}
+		if err = updateTrackedRef(r, sparseCheckoutPaths(conf, r, []*config.Repository{repo})); err != nil {
+			return fmt.Errorf("failed to update repository %s: %w", r.Name, err)
+		}
+	}
+	if opts.DryRun {
+		defer func() {
+			if err := resetCheckout(conf.Root); err != nil {
+				fmt.Printf("%s: %v\n", conf.Root.Name, err)
+			}
+		}()
+	}
+	var updatedFiles []syncedFile
+	for _, file := range files {
+		if file.Template {
+			fmt.Printf("%s: skipping %s file, templates cannot be synchronized upstream\n", repo.Name, file.Name)
+			continue
+		}
+		rootFilePath := filepath.Join(conf.GetStorePath(), conf.Root.Name, file.Path)
+		_, hunks, err := syncRepoFile(conf, CommandUpstream, repo, file, rootFilePath)
+		if err != nil {
+			return fmt.Errorf("failed to sync %s repository file upstream: %s: %w", repo.Name, file.Name, err)
+		}
+		if hunks > 0 {
+			updatedFiles = append(updatedFiles, syncedFile{
+				Name:  file.Name,
+				Path:  file.Path,
+				Hunks: hunks,
+			})
+		}
+	}
+	if len(updatedFiles) == 0 {
+		fmt.Println("No changes to synchronize upstream.")
+		return nil
+	}
+	root := conf.Root
+	if err = runHooks(conf, root, updatedFiles); err != nil {
+		if resetErr := resetCheckout(root); resetErr != nil {
+			fmt.Printf("%s: %v\n", root.Name, resetErr)
+		}
+		return fmt.Errorf("failed to run %s repository hooks: %w", root.Name, err)
+	}
+	changed, err := hasChanges(root)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		fmt.Printf("%s: no changes left after running hooks\n", root.Name)
+		return nil
+	}
+	sha, err := headCommit(repo)
+	if err != nil {
+		return err
+	}
+	details, err := renderUpstreamChangeDetails(newUpstreamSummary(root, repo, sha, updatedFiles))
+	if err != nil {
+		return err
+	}
+	if opts.DryRun {
+		return printChangeDetails(root, details)
+	}
+	if err = commitChanges(root, details); err != nil {
+		return fmt.Errorf("failed to commit changes to %s repository: %w", root.Name, err)
+	}
+	if root.GetDelivery() == config.DeliveryLocal {
+		fmt.Printf("%s: changes committed to %s branch in %s\n", root.Name, details.Branch, root.GetPath())
+		return nil
+	}
+	f := newGitHubForge()
+	remote := "origin"
+	if root.Fork != nil {
+		if err = setupFork(f, root); err != nil {
+			return fmt.Errorf("failed to set up fork of %s repository: %w", root.Name, err)
+		}
+		remote = forkRemote
+	}
+	if root.GetDelivery() == config.DeliveryPush && root.PushBranch != "" {
+		_, err = pushToBranch(root, remote, root.PushBranch)
+	} else {
+		_, err = pushChanges(root, remote, details)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to push changes to %s repository: %w", root.Name, err)
+	}
+	if root.GetDelivery() == config.DeliveryPush {
+		return nil
+	}
+	if _, err = openPullRequest(f, root, details, 0); err != nil {
+		return fmt.Errorf("failed to open pull request for %s repository: %w", root.Name, err)
+	}
+	return nil
+}
+
+// selectUpstreamFiles returns the files synchronized with the repository.
+// If names are provided, only the files with these names are returned.
+func selectUpstreamFiles(conf *config.Config, repo *config.Repository, names []string) ([]*config.File, error) {
+	files := make([]*config.File, 0, len(conf.SyncFiles))
+	for _, file := range conf.SyncFiles {
+		if len(names) > 0 && !slices.Contains(names, file.Name) {
+			continue
+		}
+		if !file.Matches(repo) {
+			if len(names) > 0 {
+				return nil, fmt.Errorf("file '%s' is not synchronized with %s repository", file.Name, repo.Name)
+			}
+			continue
+		}
+		files = append(files, file)
+	}
+	for _, name := range names {
+		if !slices.ContainsFunc(conf.SyncFiles, func(f *config.File) bool { return f.Name == name }) {
+			return nil, fmt.Errorf("file '%s' is not defined in the config", name)
+		}
+	}
+	return files, nil
+}
+
+func newUpstreamSummary(root, repo *config.Repository, sha string, files []syncedFile) upstreamSummary {
+	summary := upstreamSummary{
+		Repository:    repo,
+		Root:          root,
+		RepositoryURL: webURL(repo.URL),
+		SHA:           sha,
+		ShortSHA:      shortSHA(sha),
+		CommitURL:     commitURL(repo.URL, sha),
+		Files:         make([]syncedFile, 0, len(files)),
+	}
+	if summary.RepositoryURL == "" {
+		summary.RepositoryURL = strings.TrimSuffix(repo.URL, ".git")
+	}
+	for _, file := range files {
+		file.URL = fileURL(repo.URL, sha, file.Path)
+		summary.Files = append(summary.Files, file)
+	}
+	return summary
+}
+
+// renderUpstreamChangeDetails executes the upstream templates.
+// Unlike [renderChangeDetails], they cannot be customized through [config.Templates],
+// which describe the changes synchronized from the root repository.
+func renderUpstreamChangeDetails(summary upstreamSummary) (*changeDetails, error) {
+	var details changeDetails
+	for _, tpl := range []struct {
+		name, text string
+		result     *string
+	}{
+		{"branch", upstreamBranchTemplate, &details.Branch},
+		{"commitTitle", upstreamCommitTitleTemplate, &details.CommitTitle},
+		{"commitBody", upstreamCommitBodyTemplate, &details.CommitBody},
+		{"pullRequestBody", upstreamPullRequestBodyTemplate, &details.PullRequestBody},
+	} {
+		result, err := executeTemplate(tpl.name, tpl.text, summary)
+		if err != nil {
+			return nil, err
+		}
+		*tpl.result = strings.TrimSpace(result)
+	}
+	details.PullRequestTitle = details.CommitTitle
+	if _, err := execCmd("git", "check-ref-format", "--branch", details.Branch); err != nil {
+		return nil, fmt.Errorf("invalid branch name %q rendered for %s repository", details.Branch,
+			summary.Repository.Name)
+	}
+	return &details, nil
+}
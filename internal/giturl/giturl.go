@@ -0,0 +1,185 @@
+// Package giturl parses the repository URLs accepted by git.
+//
+// Ref: https://git-scm.com/docs/git-clone#_git_urls.
+package giturl
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	SchemeHTTPS = "https"
+	SchemeHTTP  = "http"
+	SchemeSSH   = "ssh"
+	SchemeGit   = "git"
+	SchemeFile  = "file"
+)
+
+// URL is a parsed repository URL.
+type URL struct {
+	// Scheme is the transport protocol, scp-like URLs use [SchemeSSH] and local paths use [SchemeFile].
+	Scheme string
+	// User is the user name, e.g. 'git' for 'git@github.com:nieomylnieja/gitsync.git'.
+	User string
+	// Host is the host name without the port, empty for local repositories.
+	Host string
+	// Port is empty if it was not specified.
+	Port string
+	// Owner is the path of the repository's owner, e.g. 'nieomylnieja' or 'group/subgroup'.
+	// For local repositories it is the parent directory of the repository.
+	Owner string
+	// Name is the name of the repository without the '.git' suffix.
+	Name string
+}
+
+// Parse parses https, http, ssh, git, file, scp-like ('[user@]host:path') URLs and local paths.
+func Parse(rawURL string) (*URL, error) {
+	if rawURL == "" {
+		return nil, errors.New("empty repository URL")
+	}
+	var u *URL
+	var err error
+	switch {
+	case strings.Contains(rawURL, "://"):
+		u, err = parseURL(rawURL)
+	case isSCPLike(rawURL):
+		u = parseSCPLike(rawURL)
+	default:
+		u = &URL{Scheme: SchemeFile}
+		u.setPath(filepath.ToSlash(rawURL))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if u.Name == "" {
+		return nil, fmt.Errorf("repository URL has no repository name: %s", rawURL)
+	}
+	if u.Host == "" && u.Scheme != SchemeFile {
+		return nil, fmt.Errorf("repository URL has no host: %s", rawURL)
+	}
+	return u, nil
+}
+
+// IsLocal reports whether the URL points to a repository on the local file system.
+func (u *URL) IsLocal() bool {
+	return u.Scheme == SchemeFile
+}
+
+// FullName returns the owner and name of the repository, e.g. 'nieomylnieja/gitsync'.
+func (u *URL) FullName() string {
+	if u.Owner == "" {
+		return u.Name
+	}
+	return u.Owner + "/" + u.Name
+}
+
+// String returns the host, owner and name of the repository, e.g. 'github.com/nieomylnieja/gitsync'.
+// This is the format accepted by forge CLIs, like 'gh --repo'.
+func (u *URL) String() string {
+	if u.Host == "" {
+		return u.FullName()
+	}
+	return u.Host + "/" + u.FullName()
+}
+
+// WebURL returns the URL of the repository's web page, e.g. 'https://github.com/nieomylnieja/gitsync',
+// or an empty string for local repositories.
+// The http and https URLs keep their scheme and port, other transports are served over https
+// on the default port, since their port is not the one of the web server.
+func (u *URL) WebURL() string {
+	if u.IsLocal() {
+		return ""
+	}
+	web := url.URL{Scheme: SchemeHTTPS, Host: u.Host, Path: "/" + u.FullName()}
+	if strings.Contains(u.Host, ":") {
+		// IPv6 address.
+		web.Host = "[" + u.Host + "]"
+	}
+	if u.Scheme == SchemeHTTP || u.Scheme == SchemeHTTPS {
+		web.Scheme = u.Scheme
+		if u.Port != "" {
+			web.Host = net.JoinHostPort(u.Host, u.Port)
+		}
+	}
+	return web.String()
+}
+
+func parseURL(rawURL string) (*URL, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse repository URL: %w", err)
+	}
+	u := &URL{
+		Scheme: strings.ToLower(parsed.Scheme),
+		Host:   parsed.Hostname(),
+		Port:   parsed.Port(),
+	}
+	switch u.Scheme {
+	case SchemeHTTPS, SchemeHTTP, SchemeSSH, SchemeGit, SchemeFile:
+	case "git+ssh", "ssh+git":
+		u.Scheme = SchemeSSH
+	default:
+		return nil, fmt.Errorf("unsupported repository URL scheme: %s", parsed.Scheme)
+	}
+	if parsed.User != nil {
+		u.User = parsed.User.Username()
+	}
+	repoPath := parsed.Path
+	if u.Scheme != SchemeFile {
+		repoPath = strings.TrimPrefix(repoPath, "/")
+		// Home directory expansion, e.g. 'ssh://host/~user/repo.git'.
+		repoPath = strings.TrimPrefix(repoPath, "~")
+	}
+	u.setPath(repoPath)
+	return u, nil
+}
+
+// isSCPLike reports whether the URL follows the '[user@]host:path' syntax.
+// Same as git, it is only recognized if there is no slash before the first colon,
+// which distinguishes it from local paths like './foo:bar'.
+// Windows drive letters, like 'C:\repo', are treated as local paths.
+func isSCPLike(rawURL string) bool {
+	colon := strings.IndexByte(rawURL, ':')
+	if colon <= 0 {
+		return false
+	}
+	if slash := strings.IndexAny(rawURL, `/\`); slash != -1 && slash < colon {
+		return false
+	}
+	return !(colon == 1 && filepath.VolumeName(rawURL) != "")
+}
+
+func parseSCPLike(rawURL string) *URL {
+	host, repoPath, _ := strings.Cut(rawURL, ":")
+	u := &URL{Scheme: SchemeSSH}
+	if user, h, found := strings.Cut(host, "@"); found {
+		u.User, host = user, h
+	}
+	u.Host = strings.Trim(host, "[]")
+	u.setPath(strings.TrimPrefix(strings.TrimPrefix(repoPath, "/"), "~"))
+	return u
+}
+
+// setPath sets the owner and name of the repository from the (slash separated) path.
+func (u *URL) setPath(repoPath string) {
+	repoPath = strings.TrimSuffix(strings.TrimRight(repoPath, "/"), ".git")
+	repoPath = strings.TrimRight(repoPath, "/")
+	if repoPath == "" {
+		return
+	}
+	owner, name := path.Split(repoPath)
+	if name == "." || name == ".." {
+		return
+	}
+	u.Name = name
+	u.Owner = strings.TrimRight(owner, "/")
+	if u.Scheme != SchemeFile {
+		u.Owner = strings.TrimLeft(u.Owner, "/")
+	}
+}
@@ -0,0 +1,130 @@
+package giturl
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := map[string]struct {
+		rawURL   string
+		expected URL
+		str      string
+	}{
+		"https": {
+			rawURL:   "https://github.com/nieomylnieja/gitsync.git",
+			expected: URL{Scheme: SchemeHTTPS, Host: "github.com", Owner: "nieomylnieja", Name: "gitsync"},
+			str:      "github.com/nieomylnieja/gitsync",
+		},
+		"https without .git suffix": {
+			rawURL:   "https://github.com/nieomylnieja/gitsync/",
+			expected: URL{Scheme: SchemeHTTPS, Host: "github.com", Owner: "nieomylnieja", Name: "gitsync"},
+			str:      "github.com/nieomylnieja/gitsync",
+		},
+		"https with user and port": {
+			rawURL: "https://token@git.example.com:8443/group/subgroup/gitsync.git",
+			expected: URL{Scheme: SchemeHTTPS, User: "token", Host: "git.example.com", Port: "8443",
+				Owner: "group/subgroup", Name: "gitsync"},
+			str: "git.example.com/group/subgroup/gitsync",
+		},
+		"ssh": {
+			rawURL: "ssh://git@github.com:22/nieomylnieja/gitsync.git",
+			expected: URL{Scheme: SchemeSSH, User: "git", Host: "github.com", Port: "22",
+				Owner: "nieomylnieja", Name: "gitsync"},
+			str: "github.com/nieomylnieja/gitsync",
+		},
+		"git+ssh": {
+			rawURL:   "git+ssh://github.com/nieomylnieja/gitsync.git",
+			expected: URL{Scheme: SchemeSSH, Host: "github.com", Owner: "nieomylnieja", Name: "gitsync"},
+			str:      "github.com/nieomylnieja/gitsync",
+		},
+		"git": {
+			rawURL:   "git://github.com/nieomylnieja/gitsync.git",
+			expected: URL{Scheme: SchemeGit, Host: "github.com", Owner: "nieomylnieja", Name: "gitsync"},
+			str:      "github.com/nieomylnieja/gitsync",
+		},
+		"scp-like": {
+			rawURL:   "git@github.com:nieomylnieja/gitsync.git",
+			expected: URL{Scheme: SchemeSSH, User: "git", Host: "github.com", Owner: "nieomylnieja", Name: "gitsync"},
+			str:      "github.com/nieomylnieja/gitsync",
+		},
+		"scp-like without user": {
+			rawURL:   "github.com:nieomylnieja/gitsync",
+			expected: URL{Scheme: SchemeSSH, Host: "github.com", Owner: "nieomylnieja", Name: "gitsync"},
+			str:      "github.com/nieomylnieja/gitsync",
+		},
+		"scp-like with home directory": {
+			rawURL:   "git@example.com:~nieomylnieja/gitsync.git",
+			expected: URL{Scheme: SchemeSSH, User: "git", Host: "example.com", Owner: "nieomylnieja", Name: "gitsync"},
+			str:      "example.com/nieomylnieja/gitsync",
+		},
+		"file": {
+			rawURL:   "file:///home/nieomylnieja/gitsync.git",
+			expected: URL{Scheme: SchemeFile, Owner: "/home/nieomylnieja", Name: "gitsync"},
+			str:      "/home/nieomylnieja/gitsync",
+		},
+		"absolute path": {
+			rawURL:   "/home/nieomylnieja/gitsync",
+			expected: URL{Scheme: SchemeFile, Owner: "/home/nieomylnieja", Name: "gitsync"},
+			str:      "/home/nieomylnieja/gitsync",
+		},
+		"relative path with colon": {
+			rawURL:   "./repos/git:sync",
+			expected: URL{Scheme: SchemeFile, Owner: "./repos", Name: "git:sync"},
+			str:      "./repos/git:sync",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			u, err := Parse(test.rawURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *u != test.expected {
+				t.Errorf("expected %+v, got %+v", test.expected, *u)
+			}
+			if str := u.String(); str != test.str {
+				t.Errorf("expected %q, got %q", test.str, str)
+			}
+		})
+	}
+}
+
+func TestURL_WebURL(t *testing.T) {
+	tests := map[string]string{
+		"https://github.com/nieomylnieja/gitsync.git":             "https://github.com/nieomylnieja/gitsync",
+		"http://git.example.com:8080/group/subgroup/gitsync.git":  "http://git.example.com:8080/group/subgroup/gitsync",
+		"https://token@git.example.com:8443/nieomylnieja/gitsync": "https://git.example.com:8443/nieomylnieja/gitsync",
+		"ssh://git@git.example.com:2222/nieomylnieja/gitsync.git": "https://git.example.com/nieomylnieja/gitsync",
+		"git@github.com:nieomylnieja/gitsync.git":                 "https://github.com/nieomylnieja/gitsync",
+		"https://[2001:db8::1]:8443/nieomylnieja/gitsync.git":     "https://[2001:db8::1]:8443/nieomylnieja/gitsync",
+		"/home/nieomylnieja/gitsync":                              "",
+	}
+	for rawURL, expected := range tests {
+		t.Run(rawURL, func(t *testing.T) {
+			u, err := Parse(rawURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if web := u.WebURL(); web != expected {
+				t.Errorf("expected %q, got %q", expected, web)
+			}
+		})
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, rawURL := range []string{
+		"",
+		"https://github.com",
+		"https:///nieomylnieja/gitsync.git",
+		"ftp://github.com/nieomylnieja/gitsync.git",
+		"git@github.com:",
+		".",
+	} {
+		t.Run(rawURL, func(t *testing.T) {
+			if _, err := Parse(rawURL); err == nil {
+				t.Errorf("expected an error for %q", rawURL)
+			}
+		})
+	}
+}